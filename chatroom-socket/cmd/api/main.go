@@ -30,6 +30,27 @@ var (
 	jwtSecret             string
 	port                  int
 	requestTimeoutSeconds int
+
+	orphanedRoomCheckSeconds   int
+	archivedRoomPurgeSeconds   int
+	archivedRoomRetentionHours int
+	ephemeralRoomCheckSeconds  int
+	roomReconcileSeconds       int
+	sessionGracePeriod         time.Duration
+	presenceAwayAfter          time.Duration
+	presenceCheckSeconds       int
+	sanctionPruneSeconds       int
+	socketConfig               service.SocketConfig
+)
+
+const (
+	defaultOrphanedRoomCheckSeconds   = 300
+	defaultArchivedRoomPurgeSeconds   = 3600
+	defaultArchivedRoomRetentionHours = 30 * 24
+	defaultEphemeralRoomCheckSeconds  = 30
+	defaultRoomReconcileSeconds       = 60
+	defaultPresenceCheckSeconds       = 30
+	defaultSanctionPruneSeconds       = 60
 )
 
 func init() {
@@ -41,6 +62,55 @@ func init() {
 	jwtSecret = os.Getenv("JWT_SECRET")
 	requestTimeoutSeconds, _ = strconv.Atoi(os.Getenv("REQUEST_TIMEOUT_SECONDS"))
 	port, _ = strconv.Atoi(os.Getenv("PORT"))
+	orphanedRoomCheckSeconds, _ = strconv.Atoi(os.Getenv("ORPHANED_ROOM_CHECK_SECONDS"))
+	if orphanedRoomCheckSeconds <= 0 {
+		orphanedRoomCheckSeconds = defaultOrphanedRoomCheckSeconds
+	}
+	archivedRoomPurgeSeconds, _ = strconv.Atoi(os.Getenv("ARCHIVED_ROOM_PURGE_SECONDS"))
+	if archivedRoomPurgeSeconds <= 0 {
+		archivedRoomPurgeSeconds = defaultArchivedRoomPurgeSeconds
+	}
+	archivedRoomRetentionHours, _ = strconv.Atoi(os.Getenv("ARCHIVED_ROOM_RETENTION_HOURS"))
+	if archivedRoomRetentionHours <= 0 {
+		archivedRoomRetentionHours = defaultArchivedRoomRetentionHours
+	}
+	ephemeralRoomCheckSeconds, _ = strconv.Atoi(os.Getenv("EPHEMERAL_ROOM_CHECK_SECONDS"))
+	if ephemeralRoomCheckSeconds <= 0 {
+		ephemeralRoomCheckSeconds = defaultEphemeralRoomCheckSeconds
+	}
+	roomReconcileSeconds, _ = strconv.Atoi(os.Getenv("ROOM_RECONCILE_SECONDS"))
+	if roomReconcileSeconds <= 0 {
+		roomReconcileSeconds = defaultRoomReconcileSeconds
+	}
+	sessionGracePeriod = service.DefaultSessionGracePeriod
+	if sessionGraceSeconds, _ := strconv.Atoi(os.Getenv("SESSION_GRACE_SECONDS")); sessionGraceSeconds > 0 {
+		sessionGracePeriod = time.Duration(sessionGraceSeconds) * time.Second
+	}
+	presenceAwayAfter = service.DefaultAwayAfter
+	if awaySeconds, _ := strconv.Atoi(os.Getenv("PRESENCE_AWAY_SECONDS")); awaySeconds > 0 {
+		presenceAwayAfter = time.Duration(awaySeconds) * time.Second
+	}
+	presenceCheckSeconds, _ = strconv.Atoi(os.Getenv("PRESENCE_CHECK_SECONDS"))
+	if presenceCheckSeconds <= 0 {
+		presenceCheckSeconds = defaultPresenceCheckSeconds
+	}
+	sanctionPruneSeconds, _ = strconv.Atoi(os.Getenv("SANCTION_PRUNE_SECONDS"))
+	if sanctionPruneSeconds <= 0 {
+		sanctionPruneSeconds = defaultSanctionPruneSeconds
+	}
+	socketConfig = service.DefaultSocketConfig()
+	if sendQueueSize, _ := strconv.Atoi(os.Getenv("SOCKET_SEND_QUEUE_SIZE")); sendQueueSize > 0 {
+		socketConfig.SendQueueSize = sendQueueSize
+	}
+	if pingSeconds, _ := strconv.Atoi(os.Getenv("SOCKET_PING_SECONDS")); pingSeconds > 0 {
+		socketConfig.PingInterval = time.Duration(pingSeconds) * time.Second
+	}
+	if pongTimeoutSeconds, _ := strconv.Atoi(os.Getenv("SOCKET_PONG_TIMEOUT_SECONDS")); pongTimeoutSeconds > 0 {
+		socketConfig.PongTimeout = time.Duration(pongTimeoutSeconds) * time.Second
+	}
+	if writeTimeoutSeconds, _ := strconv.Atoi(os.Getenv("SOCKET_WRITE_TIMEOUT_SECONDS")); writeTimeoutSeconds > 0 {
+		socketConfig.WriteTimeout = time.Duration(writeTimeoutSeconds) * time.Second
+	}
 }
 
 func gracefulShutdown(apiServer *http.Server) {
@@ -89,27 +159,69 @@ func main() {
 	if err != nil {
 		log.Fatalln(err)
 	}
+	if err := repository.CreateTables(sqlxEngine); err != nil {
+		log.Fatalln(err)
+	}
 
+	socketService := service.NewSocketService(socketConfig)
+	go socketService.WatchDeadConnections(context.Background(), socketConfig.PingInterval)
 	chatRoomRepository := repository.NewChatRoomRepository(sqlxEngine)
-	roomService, err := service.NewRoomService(chatRoomRepository)
+	chatMessageRepository := repository.NewChatMessageRepository(sqlxEngine)
+	roomService, err := service.NewRoomService(chatRoomRepository, chatMessageRepository, socketService)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	socketService := service.NewSocketService()
-	chatMessageRepository := repository.NewChatMessageRepository(sqlxEngine)
-	chatMessageService := service.NewChatMessageService(roomService, chatMessageRepository)
+	go roomService.WatchOrphanedRooms(context.Background(), time.Duration(orphanedRoomCheckSeconds)*time.Second)
+	go roomService.WatchArchivedRooms(
+		context.Background(),
+		time.Duration(archivedRoomPurgeSeconds)*time.Second,
+		time.Duration(archivedRoomRetentionHours)*time.Hour,
+	)
+	go roomService.WatchEphemeralRooms(context.Background(), time.Duration(ephemeralRoomCheckSeconds)*time.Second)
+	go roomService.WatchExpiredSanctions(context.Background(), time.Duration(sanctionPruneSeconds)*time.Second)
+	sessionService := service.NewSessionService(roomService, sessionGracePeriod)
+	roomChangeListener, err := repository.NewRoomChangeListener(sqlConnectionUrl)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	roomChanges := roomChangeListener.RoomChanges(context.Background())
+	go roomService.WatchRoomChanges(context.Background(), roomChanges, time.Duration(roomReconcileSeconds)*time.Second)
+	directConversationRepository := repository.NewDirectConversationRepository(sqlxEngine)
+	directMessageService := service.NewDirectMessageService(socketService, chatMessageRepository, directConversationRepository)
+	chatMessageService := service.NewChatMessageService(roomService, chatMessageRepository, repository.NewMentionRepository(sqlxEngine))
+	socketEventRegistry := service.NewSocketEventRegistry(roomService)
+	if err := roomService.RegisterSocketEvents(socketEventRegistry); err != nil {
+		log.Fatalln(err)
+	}
+	if err := chatMessageService.RegisterSocketEvents(socketEventRegistry); err != nil {
+		log.Fatalln(err)
+	}
+	if err := directMessageService.RegisterSocketEvents(socketEventRegistry); err != nil {
+		log.Fatalln(err)
+	}
+	presenceService := service.NewPresenceService(socketService, roomService, repository.NewUserPresenceRepository(sqlxEngine), presenceAwayAfter)
+	roomService.SetPresenceReader(presenceService)
+	go presenceService.WatchIdleUsers(context.Background(), time.Duration(presenceCheckSeconds)*time.Second)
+	if err := presenceService.RegisterSocketEvents(socketEventRegistry); err != nil {
+		log.Fatalln(err)
+	}
 	assistantService, err := service.NewAssistantService(sqlxEngine, chatMessageService)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	if err := assistantService.RegisterSocketEvents(socketEventRegistry); err != nil {
+		log.Fatalln(err)
+	}
 
 	httpRouter := serverEngine.Group("/api")
 	socketRouter := serverEngine.Group("/ws-api")
 	controllers := []server.Controller{
 		controller.NewRoomController(httpRouter, roomService, socketService, requestTimeoutSeconds),
-		controller.NewSocketController(socketRouter, socketService, roomService, chatMessageService, requestTimeoutSeconds),
+		controller.NewSocketController(socketRouter, socketService, roomService, sessionService, socketEventRegistry, presenceService, requestTimeoutSeconds),
 		controller.NewChatMessageController(httpRouter, roomService, chatMessageService, requestTimeoutSeconds),
 		controller.NewAssistantController(serverEngine, assistantService),
+		controller.NewDirectMessageController(httpRouter, directMessageService, requestTimeoutSeconds),
+		controller.NewPresenceController(httpRouter, presenceService, requestTimeoutSeconds),
 	}
 
 	_server := server.NewServer(serverEngine, port, controllers)
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"log"
 	"net/http"
 	"time"
@@ -16,8 +17,41 @@ import (
 type IChatMessageRepository interface {
 	GetAllMessagesByRoomId(roomId uuid.UUID, offset uint, limit uint) ([]*ChatMessage, error)
 	SaveMessageToRoomId(ctx context.Context, message *ChatMessage) (*ChatMessage, error)
+	GetMessageById(ctx context.Context, messageId string) (*ChatMessage, error)
+	SaveReadMarker(ctx context.Context, marker *ReadMarker) (*ReadMarker, error)
+	GetUnreadCounts(ctx context.Context, userId int) ([]UnreadCount, error)
+	EditMessage(ctx context.Context, messageId string, content string, editedBy int) (*ChatMessage, error)
+	DeleteMessage(ctx context.Context, messageId string, deletedBy int) error
+	GetMessageEdits(ctx context.Context, messageId string) ([]ChatMessageEdit, error)
+	AddReaction(ctx context.Context, messageId string, userId int, emoji string, limits ReactionLimits) (bool, error)
+	RemoveReaction(ctx context.Context, messageId string, userId int, emoji string) (bool, error)
+	GetReactionCounts(ctx context.Context, messageIds []string) (map[string][]ReactionCount, error)
+	GetThreadMessages(ctx context.Context, parentId string, offset uint, limit uint) ([]*ChatMessage, error)
+	GetThreadParticipantIds(ctx context.Context, parentId string) ([]int, error)
+	PinMessage(ctx context.Context, pin *ChatMessagePin, maxPins int) (bool, error)
+	UnpinMessage(ctx context.Context, messageId string) (bool, error)
+	GetPinnedMessages(ctx context.Context, roomId uuid.UUID) ([]PinnedMessage, error)
 }
 
+// selectChatMessageSql flags deleted messages. Tombstones live in their own table because the admin service owns chat_message.
+const selectChatMessageSql = `SELECT message.*, (deletion.message_id IS NOT NULL) AS is_deleted,
+		thread.parent_id, replies.reply_count, replies.last_reply_at
+	FROM chat_message message
+	LEFT JOIN chat_message_deletion deletion ON deletion.message_id = message.id
+	LEFT JOIN chat_message_thread thread ON thread.message_id = message.id
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS reply_count, MAX(reply.created_at) AS last_reply_at
+		FROM chat_message_thread reply_thread
+		JOIN chat_message reply ON reply.id = reply_thread.message_id
+		WHERE reply_thread.parent_id = message.id
+	) replies ON TRUE`
+
+var (
+	ErrUserReactionLimit = errors.New("user reached the reaction limit of the message")
+	ErrMessageEmojiLimit = errors.New("message reached the emoji limit")
+	ErrRoomPinLimit      = errors.New("room reached the pin limit")
+)
+
 type ChatMessageRepository struct {
 	httpClient *http.Client
 	Engine     *sqlx.DB
@@ -46,7 +80,7 @@ func NewChatMessage(roomId uuid.UUID, senderId int, content string) (*ChatMessag
 }
 
 func (repository *ChatMessageRepository) GetAllMessagesByRoomId(roomId uuid.UUID, offset uint, limit uint) ([]*ChatMessage, error) {
-	sql := "SELECT * FROM chat_message WHERE room_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3"
+	sql := selectChatMessageSql + " WHERE message.room_id = $1 ORDER BY message.created_at DESC LIMIT $2 OFFSET $3"
 	log.Println(sql, roomId, limit, offset)
 	var chatMessages []*ChatMessage
 	err := repository.Engine.Select(&chatMessages, sql, roomId, limit, offset)
@@ -57,15 +91,39 @@ func (repository *ChatMessageRepository) GetAllMessagesByRoomId(roomId uuid.UUID
 	for _, chatMessage := range chatMessages {
 		chatMessage.IsCommitted = true
 	}
+	if err := repository.attachReactions(context.Background(), chatMessages); err != nil {
+		return nil, err
+	}
 
 	return chatMessages, nil
 }
 
+func (repository *ChatMessageRepository) attachReactions(ctx context.Context, chatMessages []*ChatMessage) error {
+	messageIds := make([]string, 0, len(chatMessages))
+	for _, chatMessage := range chatMessages {
+		messageIds = append(messageIds, chatMessage.ID)
+	}
+	reactionCounts, err := repository.GetReactionCounts(ctx, messageIds)
+	if err != nil {
+		return err
+	}
+	for _, chatMessage := range chatMessages {
+		chatMessage.Reactions = reactionCounts[chatMessage.ID]
+		if chatMessage.Reactions == nil {
+			chatMessage.Reactions = []ReactionCount{}
+		}
+	}
+	return nil
+}
+
 func (repository *ChatMessageRepository) SaveMessageToRoomId(ctx context.Context, chatMessage *ChatMessage) (*ChatMessage, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
+		if chatMessage.ParentId != nil {
+			return repository.saveThreadReply(ctx, chatMessage)
+		}
 		body, err := json.Marshal(chatMessage)
 		if err != nil {
 			return nil, err
@@ -81,8 +139,397 @@ func (repository *ChatMessageRepository) SaveMessageToRoomId(ctx context.Context
 			return nil, err
 		}
 		responseBody.Message.IsCommitted = true
-
 		return &responseBody.Message, nil
 	}
 
 }
+
+// saveThreadReply inserts the reply and files it under its parent in one transaction, so that a reply
+// is never saved without its thread.
+func (repository *ChatMessageRepository) saveThreadReply(ctx context.Context, reply *ChatMessage) (*ChatMessage, error) {
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	messageType := reply.MessageType
+	if len(messageType) == 0 {
+		messageType = HumanMessageType
+	}
+	sql := `INSERT INTO chat_message (id, content, room_id, sender_id, created_at, message_type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *`
+	var saved ChatMessage
+	if err := tx.GetContext(ctx, &saved, sql, reply.ID, reply.Content, reply.RoomId, reply.SenderId, reply.CreatedAt, messageType); err != nil {
+		return nil, err
+	}
+	threadSql := "INSERT INTO chat_message_thread (message_id, parent_id) VALUES ($1, $2)"
+	if _, err := tx.ExecContext(ctx, threadSql, saved.ID, *reply.ParentId); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	saved.IsCommitted = true
+	saved.ParentId = reply.ParentId
+	return &saved, nil
+}
+
+func (repository *ChatMessageRepository) GetMessageById(ctx context.Context, messageId string) (*ChatMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := selectChatMessageSql + " WHERE message.id = $1"
+		var chatMessage ChatMessage
+		if err := repository.Engine.Get(&chatMessage, sql, messageId); err != nil {
+			return nil, err
+		}
+		chatMessage.IsCommitted = true
+		return &chatMessage, nil
+	}
+}
+
+// SaveReadMarker moves the marker of the user forward. An older marker never replaces a newer one,
+// in which case the stored marker is returned.
+func (repository *ChatMessageRepository) SaveReadMarker(ctx context.Context, marker *ReadMarker) (*ReadMarker, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `INSERT INTO chat_room_read_marker (room_id, user_id, last_read_message_id, last_read_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (room_id, user_id) DO UPDATE
+			SET last_read_message_id = EXCLUDED.last_read_message_id, last_read_at = EXCLUDED.last_read_at, updated_at = NOW()
+			WHERE chat_room_read_marker.last_read_at < EXCLUDED.last_read_at`
+		if _, err := repository.Engine.ExecContext(ctx, sql, marker.RoomId, marker.UserId, marker.LastReadMessageId, marker.LastReadAt); err != nil {
+			return nil, err
+		}
+		var savedMarker ReadMarker
+		sql = "SELECT room_id, user_id, last_read_message_id, last_read_at FROM chat_room_read_marker WHERE room_id = $1 AND user_id = $2"
+		if err := repository.Engine.GetContext(ctx, &savedMarker, sql, marker.RoomId, marker.UserId); err != nil {
+			return nil, err
+		}
+		return &savedMarker, nil
+	}
+}
+
+// GetUnreadCounts counts, for every room the user is a member of, the messages of other users after their read marker.
+func (repository *ChatMessageRepository) GetUnreadCounts(ctx context.Context, userId int) ([]UnreadCount, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT member.room_id, COUNT(message.id) AS unread_count, marker.last_read_at
+			FROM chat_room_member member
+			JOIN chat_room room ON room.id = member.room_id
+			LEFT JOIN chat_room_read_marker marker ON marker.room_id = member.room_id AND marker.user_id = member.user_id
+			LEFT JOIN chat_message message ON message.room_id = member.room_id
+				AND message.sender_id <> member.user_id
+				AND (marker.last_read_at IS NULL OR message.created_at > marker.last_read_at)
+			WHERE member.user_id = $1
+			GROUP BY member.room_id, marker.last_read_at`
+		unreadCounts := make([]UnreadCount, 0)
+		if err := repository.Engine.SelectContext(ctx, &unreadCounts, sql, userId); err != nil {
+			return nil, err
+		}
+		return unreadCounts, nil
+	}
+}
+
+// EditMessage replaces the content of the message and keeps the previous content in its edit history.
+func (repository *ChatMessageRepository) EditMessage(ctx context.Context, messageId string, content string, editedBy int) (*ChatMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		tx, err := repository.Engine.BeginTxx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		historySql := `INSERT INTO chat_message_edit (message_id, previous_content, edited_by)
+			SELECT id, content, $2 FROM chat_message WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, historySql, messageId, editedBy); err != nil {
+			return nil, err
+		}
+		updateSql := "UPDATE chat_message SET content = $2, updated_at = NOW() WHERE id = $1"
+		if _, err := tx.ExecContext(ctx, updateSql, messageId, content); err != nil {
+			return nil, err
+		}
+		var chatMessage ChatMessage
+		if err := tx.GetContext(ctx, &chatMessage, selectChatMessageSql+" WHERE message.id = $1", messageId); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		chatMessage.IsCommitted = true
+		return &chatMessage, nil
+	}
+}
+
+// DeleteMessage leaves a tombstone. The content and the edit history of the message are dropped.
+func (repository *ChatMessageRepository) DeleteMessage(ctx context.Context, messageId string, deletedBy int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		tx, err := repository.Engine.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		statements := []struct {
+			sql  string
+			args []any
+		}{
+			{"INSERT INTO chat_message_deletion (message_id, deleted_by) VALUES ($1, $2)", []any{messageId, deletedBy}},
+			{"UPDATE chat_message SET content = '', updated_at = NOW() WHERE id = $1", []any{messageId}},
+			{"DELETE FROM chat_message_edit WHERE message_id = $1", []any{messageId}},
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement.sql, statement.args...); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+}
+
+func (repository *ChatMessageRepository) GetMessageEdits(ctx context.Context, messageId string) ([]ChatMessageEdit, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT message_id, previous_content, edited_by, edited_at FROM chat_message_edit
+			WHERE message_id = $1 ORDER BY edited_at ASC, id ASC`
+		edits := make([]ChatMessageEdit, 0)
+		if err := repository.Engine.SelectContext(ctx, &edits, sql, messageId); err != nil {
+			return nil, err
+		}
+		return edits, nil
+	}
+}
+
+// AddReaction returns false when the user already reacted to the message with the emoji. The limits are
+// checked in the same transaction as the insert, with the message row locked, so concurrent reactions
+// can't exceed them. The emoji limit only applies to emojis that are not on the message yet.
+func (repository *ChatMessageRepository) AddReaction(ctx context.Context, messageId string, userId int, emoji string, limits ReactionLimits) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		tx, err := repository.Engine.BeginTxx(ctx, nil)
+		if err != nil {
+			return false, err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, "SELECT id FROM chat_message WHERE id = $1 FOR UPDATE", messageId); err != nil {
+			return false, err
+		}
+		statsSql := `SELECT COUNT(DISTINCT emoji) AS emoji_count,
+				COUNT(*) FILTER (WHERE user_id = $2) AS user_emoji_count,
+				COALESCE(BOOL_OR(emoji = $3), FALSE) AS has_emoji,
+				COALESCE(BOOL_OR(emoji = $3 AND user_id = $2), FALSE) AS has_reacted
+			FROM chat_message_reaction WHERE message_id = $1`
+		var stats MessageReactionStats
+		if err := tx.GetContext(ctx, &stats, statsSql, messageId, userId, emoji); err != nil {
+			return false, err
+		}
+		switch {
+		case stats.HasReacted:
+			return false, nil
+		case stats.UserEmojiCount >= limits.MaxPerUser:
+			return false, ErrUserReactionLimit
+		case !stats.HasEmoji && stats.EmojiCount >= limits.MaxEmojisPerMessage:
+			return false, ErrMessageEmojiLimit
+		}
+
+		sql := "INSERT INTO chat_message_reaction (message_id, user_id, emoji) VALUES ($1, $2, $3)"
+		if _, err := tx.ExecContext(ctx, sql, messageId, userId, emoji); err != nil {
+			return false, err
+		}
+		return true, tx.Commit()
+	}
+}
+
+func (repository *ChatMessageRepository) RemoveReaction(ctx context.Context, messageId string, userId int, emoji string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		sql := "DELETE FROM chat_message_reaction WHERE message_id = $1 AND user_id = $2 AND emoji = $3"
+		result, err := repository.Engine.ExecContext(ctx, sql, messageId, userId, emoji)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		return affected > 0, err
+	}
+}
+
+// GetReactionCounts returns the reaction counts of the messages keyed by message id.
+func (repository *ChatMessageRepository) GetReactionCounts(ctx context.Context, messageIds []string) (map[string][]ReactionCount, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		reactionCounts := make(map[string][]ReactionCount)
+		if len(messageIds) == 0 {
+			return reactionCounts, nil
+		}
+		sql := `SELECT message_id, emoji, COUNT(*) AS count FROM chat_message_reaction
+			WHERE message_id = ANY($1::UUID[])
+			GROUP BY message_id, emoji
+			ORDER BY MIN(created_at)`
+		var rows []struct {
+			MessageId string `db:"message_id"`
+			ReactionCount
+		}
+		if err := repository.Engine.SelectContext(ctx, &rows, sql, pq.Array(messageIds)); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			reactionCounts[row.MessageId] = append(reactionCounts[row.MessageId], row.ReactionCount)
+		}
+		return reactionCounts, nil
+	}
+}
+
+// GetThreadMessages returns the replies to the parent message, oldest first.
+func (repository *ChatMessageRepository) GetThreadMessages(ctx context.Context, parentId string, offset uint, limit uint) ([]*ChatMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := selectChatMessageSql + " WHERE thread.parent_id = $1 ORDER BY message.created_at ASC LIMIT $2 OFFSET $3"
+		chatMessages := make([]*ChatMessage, 0)
+		if err := repository.Engine.SelectContext(ctx, &chatMessages, sql, parentId, limit, offset); err != nil {
+			return nil, err
+		}
+		for _, chatMessage := range chatMessages {
+			chatMessage.IsCommitted = true
+		}
+		if err := repository.attachReactions(ctx, chatMessages); err != nil {
+			return nil, err
+		}
+		return chatMessages, nil
+	}
+}
+
+// GetThreadParticipantIds returns the sender of the parent message and everyone who replied to it.
+func (repository *ChatMessageRepository) GetThreadParticipantIds(ctx context.Context, parentId string) ([]int, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT sender_id FROM chat_message WHERE id = $1 AND sender_id IS NOT NULL
+			UNION
+			SELECT reply.sender_id FROM chat_message_thread thread
+			JOIN chat_message reply ON reply.id = thread.message_id
+			WHERE thread.parent_id = $1 AND reply.sender_id IS NOT NULL`
+		var userIds []int
+		if err := repository.Engine.SelectContext(ctx, &userIds, sql, parentId); err != nil {
+			return nil, err
+		}
+		return userIds, nil
+	}
+}
+
+// PinMessage pins the message unless the room already has maxPins pins. Pins of deleted messages
+// don't count. The room row is locked so that concurrent pins can't go over the limit.
+func (repository *ChatMessageRepository) PinMessage(ctx context.Context, pin *ChatMessagePin, maxPins int) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		tx, err := repository.Engine.BeginTxx(ctx, nil)
+		if err != nil {
+			return false, err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, "SELECT id FROM chat_room WHERE id = $1 FOR UPDATE", pin.RoomId); err != nil {
+			return false, err
+		}
+		countSql := `SELECT COUNT(*) FROM chat_message_pin pin
+			LEFT JOIN chat_message_deletion deletion ON deletion.message_id = pin.message_id
+			WHERE pin.room_id = $1 AND deletion.message_id IS NULL`
+		var count int
+		if err := tx.GetContext(ctx, &count, countSql, pin.RoomId); err != nil {
+			return false, err
+		}
+		if count >= maxPins {
+			return false, ErrRoomPinLimit
+		}
+
+		sql := `INSERT INTO chat_message_pin (message_id, room_id, pinned_by) VALUES ($1, $2, $3)
+			ON CONFLICT (message_id) DO NOTHING`
+		result, err := tx.ExecContext(ctx, sql, pin.MessageId, pin.RoomId, pin.PinnedBy)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return affected > 0, tx.Commit()
+	}
+}
+
+func (repository *ChatMessageRepository) UnpinMessage(ctx context.Context, messageId string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		result, err := repository.Engine.ExecContext(ctx, "DELETE FROM chat_message_pin WHERE message_id = $1", messageId)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		return affected > 0, err
+	}
+}
+
+// GetPinnedMessages returns the pinned messages of the room, latest pin first. Deleted messages are skipped.
+func (repository *ChatMessageRepository) GetPinnedMessages(ctx context.Context, roomId uuid.UUID) ([]PinnedMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT pin.* FROM chat_message_pin pin
+			LEFT JOIN chat_message_deletion deletion ON deletion.message_id = pin.message_id
+			WHERE pin.room_id = $1 AND deletion.message_id IS NULL
+			ORDER BY pin.pinned_at DESC`
+		var pins []ChatMessagePin
+		if err := repository.Engine.SelectContext(ctx, &pins, sql, roomId); err != nil {
+			return nil, err
+		}
+		sql = selectChatMessageSql + " JOIN chat_message_pin pin ON pin.message_id = message.id WHERE pin.room_id = $1"
+		var chatMessages []*ChatMessage
+		if err := repository.Engine.SelectContext(ctx, &chatMessages, sql, roomId); err != nil {
+			return nil, err
+		}
+		if err := repository.attachReactions(ctx, chatMessages); err != nil {
+			return nil, err
+		}
+		messagesById := make(map[string]*ChatMessage, len(chatMessages))
+		for _, chatMessage := range chatMessages {
+			chatMessage.IsCommitted = true
+			messagesById[chatMessage.ID] = chatMessage
+		}
+
+		pinnedMessages := make([]PinnedMessage, 0, len(pins))
+		for _, pin := range pins {
+			if message, ok := messagesById[pin.MessageId]; ok {
+				pinnedMessages = append(pinnedMessages, PinnedMessage{ChatMessagePin: pin, Message: message})
+			}
+		}
+		return pinnedMessages, nil
+	}
+}
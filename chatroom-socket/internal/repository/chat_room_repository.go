@@ -7,7 +7,9 @@ import (
 	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"net/http"
+	"time"
 )
 
 type AddRoomSchema struct {
@@ -17,6 +19,9 @@ type AddRoomSchema struct {
 	RoomType     RoomType  `json:"room_type"`
 	RoomPassword string    `json:"room_password"`
 	SettingsId   uuid.UUID `json:"settings_id"`
+	// Ephemeral rooms are archived once nobody has been in them for IdleTtlSeconds.
+	IsEphemeral    bool `json:"is_ephemeral"`
+	IdleTtlSeconds int  `json:"idle_ttl_seconds"`
 }
 
 type IChatRoomRepository interface {
@@ -25,6 +30,33 @@ type IChatRoomRepository interface {
 	DeleteRoom(ctx context.Context, roomId uuid.UUID) error
 	GetRoomSettings(ctx context.Context, roomId uuid.UUID) (*ChatRoomSettings, error)
 	GetRoomById(ctx context.Context, roomId uuid.UUID) (*Room, error)
+	AddRoomMember(ctx context.Context, roomId uuid.UUID, userId int, invitedBy *int, joinMethod RoomJoinMethod) error
+	DeletePasswordRoomMembers(ctx context.Context, roomId uuid.UUID) ([]int, error)
+	DeleteUninvitedRoomMembers(ctx context.Context, roomId uuid.UUID, ownerId int) ([]int, error)
+	UserExists(ctx context.Context, userId int) (bool, error)
+	GetRoomMembers(ctx context.Context, roomId uuid.UUID) ([]RoomMember, error)
+	IsRoomMember(ctx context.Context, roomId uuid.UUID, userId int) (bool, error)
+	CreateRoomInvite(ctx context.Context, invite *RoomInvite) (*RoomInvite, error)
+	GetRoomInvite(ctx context.Context, code string) (*RoomInvite, error)
+	UseRoomInvite(ctx context.Context, code string) (*RoomInvite, error)
+	GetRoomMember(ctx context.Context, roomId uuid.UUID, userId int) (*RoomMember, error)
+	SetRoomMemberRole(ctx context.Context, roomId uuid.UUID, userId int, role RoomRole) error
+	DeleteRoomMember(ctx context.Context, roomId uuid.UUID, userId int) error
+	SaveRoomSanction(ctx context.Context, sanction *RoomSanction) error
+	DeleteRoomSanction(ctx context.Context, roomId uuid.UUID, userId int, sanctionType SanctionType) error
+	GetActiveRoomSanctions(ctx context.Context, roomId uuid.UUID) ([]RoomSanction, error)
+	UpdateRoomSettings(ctx context.Context, roomId uuid.UUID, name string, settings *ChatRoomSettings) error
+	UpdateRoomPassword(ctx context.Context, roomId uuid.UUID, previousPassword string, password string) error
+	TransferRoomOwnership(ctx context.Context, roomId uuid.UUID, previousOwnerId *int, newOwnerId int) error
+	GetOldestRoomModerator(ctx context.Context, roomId uuid.UUID) (*RoomMember, error)
+	GetOwnerlessRoomIds(ctx context.Context) ([]uuid.UUID, error)
+	FlagOrphanedRoom(ctx context.Context, roomId uuid.UUID) error
+	GetOrphanedRooms(ctx context.Context) ([]OrphanedRoom, error)
+	GetArchivedRooms(ctx context.Context, ownerId *int) ([]ArchivedRoom, error)
+	GetArchivedRoomById(ctx context.Context, roomId uuid.UUID) (*ArchivedRoom, error)
+	RestoreRoom(ctx context.Context, roomId uuid.UUID) error
+	PurgeArchivedRooms(ctx context.Context, archivedBefore time.Time) ([]uuid.UUID, error)
+	SaveEphemeralRoom(ctx context.Context, roomId uuid.UUID, idleTtlSeconds int) error
 }
 
 type ChatRoomRepository struct {
@@ -45,10 +77,13 @@ func (repository *ChatRoomRepository) GetRoomById(ctx context.Context, roomId uu
 		return nil, ctx.Err()
 	default:
 		sql := `SELECT cr.*,
-				   crs.room_type
+				   crs.room_type,
+				   cre.idle_ttl_seconds
 			FROM   chat_room cr
 				   JOIN chat_room_settings crs
 					 ON cr.id = crs.room_id
+				   LEFT JOIN chat_room_ephemeral cre
+						  ON cr.id = cre.room_id
 			WHERE  is_deleted = false AND crs.room_id = $1`
 		var roomRead Room
 		if err := repository.Engine.Get(&roomRead, sql, roomId); err != nil {
@@ -60,10 +95,13 @@ func (repository *ChatRoomRepository) GetRoomById(ctx context.Context, roomId uu
 
 func (repository *ChatRoomRepository) GetAllRooms() ([]Room, error) {
 	sql := `SELECT cr.*,
-				   crs.room_type
+				   crs.room_type,
+				   cre.idle_ttl_seconds
 			FROM   chat_room cr
 				   JOIN chat_room_settings crs
 					 ON cr.id = crs.room_id
+				   LEFT JOIN chat_room_ephemeral cre
+						  ON cr.id = cre.room_id
 			WHERE  is_deleted = false`
 	var rooms []Room
 	if err := repository.Engine.Select(&rooms, sql); err != nil {
@@ -102,17 +140,59 @@ func (repository *ChatRoomRepository) CreateNewRoom(ctx context.Context, addRoom
 }
 
 func (repository *ChatRoomRepository) DeleteRoom(ctx context.Context, roomId uuid.UUID) error {
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE chat_room SET is_deleted = TRUE WHERE id = $1"
+	if _, err := tx.ExecContext(ctx, sql, roomId); err != nil {
+		return err
+	}
+	archiveSql := `INSERT INTO chat_room_archive (room_id)
+			VALUES ($1)
+			ON CONFLICT (room_id) DO UPDATE SET archived_at = NOW()`
+	if _, err := tx.ExecContext(ctx, archiveSql, roomId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateRoomSettings renames the room and replaces its settings in a single transaction.
+func (repository *ChatRoomRepository) UpdateRoomSettings(ctx context.Context, roomId uuid.UUID, name string, settings *ChatRoomSettings) error {
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	roomSql := "UPDATE chat_room SET name = $2, updated_at = NOW() WHERE id = $1 AND is_deleted = FALSE"
+	if _, err := tx.ExecContext(ctx, roomSql, roomId, name); err != nil {
+		return err
+	}
+	settingsSql := `UPDATE chat_room_settings
+			SET    room_type = $2,
+				   password = $3,
+				   assistant_rule = $4
+			WHERE  room_id = $1`
+	if _, err := tx.ExecContext(ctx, settingsSql, roomId, settings.RoomType, settings.Password, settings.AssistantRule); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateRoomPassword replaces the password only if it is still previousPassword, so that a concurrent
+// rotation is never overwritten.
+func (repository *ChatRoomRepository) UpdateRoomPassword(ctx context.Context, roomId uuid.UUID, previousPassword string, password string) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		sql := "UPDATE chat_room SET is_deleted = TRUE WHERE id = $1"
-		_, err := repository.Engine.Exec(sql, roomId)
-		if err != nil {
-			return err
-		}
+		sql := "UPDATE chat_room_settings SET password = $3 WHERE room_id = $1 AND password = $2"
+		_, err := repository.Engine.ExecContext(ctx, sql, roomId, previousPassword, password)
+		return err
 	}
-	return nil
 }
 
 func (repository *ChatRoomRepository) GetRoomSettings(ctx context.Context, roomId uuid.UUID) (*ChatRoomSettings, error) {
@@ -128,3 +208,447 @@ func (repository *ChatRoomRepository) GetRoomSettings(ctx context.Context, roomI
 		return &roomSettings, nil
 	}
 }
+
+// AddRoomMember keeps an existing membership, except that a password membership is upgraded
+// when the user joins again by any other method.
+func (repository *ChatRoomRepository) AddRoomMember(ctx context.Context, roomId uuid.UUID, userId int, invitedBy *int, joinMethod RoomJoinMethod) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := `INSERT INTO chat_room_member (room_id, user_id, invited_by, join_method)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (room_id, user_id) DO UPDATE
+			SET    invited_by = EXCLUDED.invited_by,
+				   join_method = EXCLUDED.join_method
+			WHERE  chat_room_member.join_method = $5 AND EXCLUDED.join_method <> $5`
+		_, err := repository.Engine.Exec(sql, roomId, userId, invitedBy, joinMethod, RoomJoinPassword)
+		return err
+	}
+}
+
+// DeletePasswordRoomMembers removes the plain members who got in with the room password
+// and returns their ids. Moderators keep their membership.
+func (repository *ChatRoomRepository) DeletePasswordRoomMembers(ctx context.Context, roomId uuid.UUID) ([]int, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `DELETE FROM chat_room_member
+			WHERE  room_id = $1 AND join_method = $2 AND role = $3
+			RETURNING user_id`
+		var userIds []int
+		if err := repository.Engine.Select(&userIds, sql, roomId, RoomJoinPassword, RoomRoleMember); err != nil {
+			return nil, err
+		}
+		return userIds, nil
+	}
+}
+
+// DeleteUninvitedRoomMembers removes the plain members who joined the room on their own while it was
+// public and returns their ids. The owner, moderators and invited members keep their membership.
+func (repository *ChatRoomRepository) DeleteUninvitedRoomMembers(ctx context.Context, roomId uuid.UUID, ownerId int) ([]int, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `DELETE FROM chat_room_member
+			WHERE  room_id = $1 AND join_method = $2 AND invited_by IS NULL AND role = $3 AND user_id <> $4
+			RETURNING user_id`
+		var userIds []int
+		if err := repository.Engine.Select(&userIds, sql, roomId, RoomJoinDirect, RoomRoleMember, ownerId); err != nil {
+			return nil, err
+		}
+		return userIds, nil
+	}
+}
+
+func (repository *ChatRoomRepository) UserExists(ctx context.Context, userId int) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		sql := "SELECT EXISTS (SELECT 1 FROM app_user WHERE id = $1)"
+		var exists bool
+		if err := repository.Engine.Get(&exists, sql, userId); err != nil {
+			return false, err
+		}
+		return exists, nil
+	}
+}
+
+func (repository *ChatRoomRepository) GetRoomMembers(ctx context.Context, roomId uuid.UUID) ([]RoomMember, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT crm.*,
+				   au.user_name
+			FROM   chat_room_member crm
+				   JOIN app_user au
+					 ON crm.user_id = au.id
+			WHERE  crm.room_id = $1
+			ORDER  BY crm.created_at`
+		var members []RoomMember
+		if err := repository.Engine.Select(&members, sql, roomId); err != nil {
+			return nil, err
+		}
+		return members, nil
+	}
+}
+
+func (repository *ChatRoomRepository) IsRoomMember(ctx context.Context, roomId uuid.UUID, userId int) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+		sql := "SELECT EXISTS (SELECT 1 FROM chat_room_member WHERE room_id = $1 AND user_id = $2)"
+		var isMember bool
+		if err := repository.Engine.Get(&isMember, sql, roomId, userId); err != nil {
+			return false, err
+		}
+		return isMember, nil
+	}
+}
+
+func (repository *ChatRoomRepository) CreateRoomInvite(ctx context.Context, invite *RoomInvite) (*RoomInvite, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `INSERT INTO chat_room_invite (code, room_id, created_by, expires_at, max_uses)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING *`
+		var inviteRead RoomInvite
+		err := repository.Engine.Get(&inviteRead, sql, invite.Code, invite.RoomId, invite.CreatedBy, invite.ExpiresAt, invite.MaxUses)
+		if err != nil {
+			return nil, err
+		}
+		return &inviteRead, nil
+	}
+}
+
+func (repository *ChatRoomRepository) GetRoomInvite(ctx context.Context, code string) (*RoomInvite, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := "SELECT * FROM chat_room_invite WHERE code = $1"
+		var inviteRead RoomInvite
+		if err := repository.Engine.Get(&inviteRead, sql, code); err != nil {
+			return nil, err
+		}
+		return &inviteRead, nil
+	}
+}
+
+// UseRoomInvite atomically consumes one use of a valid invite. It returns sql.ErrNoRows
+// when the invite does not exist, is expired or has no uses left.
+func (repository *ChatRoomRepository) UseRoomInvite(ctx context.Context, code string) (*RoomInvite, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `UPDATE chat_room_invite
+			SET    uses = uses + 1
+			WHERE  code = $1
+				   AND ( expires_at IS NULL OR expires_at > NOW() )
+				   AND ( max_uses = 0 OR uses < max_uses )
+			RETURNING *`
+		var inviteRead RoomInvite
+		if err := repository.Engine.Get(&inviteRead, sql, code); err != nil {
+			return nil, err
+		}
+		return &inviteRead, nil
+	}
+}
+
+func (repository *ChatRoomRepository) GetRoomMember(ctx context.Context, roomId uuid.UUID, userId int) (*RoomMember, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT crm.*,
+				   au.user_name
+			FROM   chat_room_member crm
+				   JOIN app_user au
+					 ON crm.user_id = au.id
+			WHERE  crm.room_id = $1 AND crm.user_id = $2`
+		var member RoomMember
+		if err := repository.Engine.Get(&member, sql, roomId, userId); err != nil {
+			return nil, err
+		}
+		return &member, nil
+	}
+}
+
+func (repository *ChatRoomRepository) SetRoomMemberRole(ctx context.Context, roomId uuid.UUID, userId int, role RoomRole) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := "UPDATE chat_room_member SET role = $3 WHERE room_id = $1 AND user_id = $2"
+		_, err := repository.Engine.Exec(sql, roomId, userId, role)
+		return err
+	}
+}
+
+func (repository *ChatRoomRepository) DeleteRoomMember(ctx context.Context, roomId uuid.UUID, userId int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := "DELETE FROM chat_room_member WHERE room_id = $1 AND user_id = $2"
+		_, err := repository.Engine.Exec(sql, roomId, userId)
+		return err
+	}
+}
+
+func (repository *ChatRoomRepository) SaveRoomSanction(ctx context.Context, sanction *RoomSanction) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := `INSERT INTO chat_room_sanction (room_id, user_id, sanction_type, issued_by, reason, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (room_id, user_id, sanction_type)
+			DO UPDATE SET issued_by = EXCLUDED.issued_by,
+						  reason = EXCLUDED.reason,
+						  expires_at = EXCLUDED.expires_at,
+						  created_at = NOW()`
+		_, err := repository.Engine.Exec(sql, sanction.RoomId, sanction.UserId, sanction.SanctionType, sanction.IssuedBy, sanction.Reason, sanction.ExpiresAt)
+		return err
+	}
+}
+
+func (repository *ChatRoomRepository) DeleteRoomSanction(ctx context.Context, roomId uuid.UUID, userId int, sanctionType SanctionType) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := "DELETE FROM chat_room_sanction WHERE room_id = $1 AND user_id = $2 AND sanction_type = $3"
+		_, err := repository.Engine.Exec(sql, roomId, userId, sanctionType)
+		return err
+	}
+}
+
+func (repository *ChatRoomRepository) GetActiveRoomSanctions(ctx context.Context, roomId uuid.UUID) ([]RoomSanction, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT *
+			FROM   chat_room_sanction
+			WHERE  room_id = $1 AND ( expires_at IS NULL OR expires_at > NOW() )`
+		var sanctions []RoomSanction
+		if err := repository.Engine.Select(&sanctions, sql, roomId); err != nil {
+			return nil, err
+		}
+		return sanctions, nil
+	}
+}
+
+// TransferRoomOwnership makes the new owner a member, demotes the previous owner to moderator
+// and clears the orphan flag of the room. A nil previous owner has no membership to demote.
+func (repository *ChatRoomRepository) TransferRoomOwnership(ctx context.Context, roomId uuid.UUID, previousOwnerId *int, newOwnerId int) error {
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		sql  string
+		args []any
+	}{
+		{"UPDATE chat_room SET owner_id = $2, updated_at = NOW() WHERE id = $1", []any{roomId, newOwnerId}},
+		{`INSERT INTO chat_room_member (room_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (room_id, user_id) DO NOTHING`, []any{roomId, newOwnerId}},
+		{"UPDATE chat_room_member SET role = $3 WHERE room_id = $1 AND user_id = $2", []any{roomId, newOwnerId, RoomRoleMember}},
+		{"UPDATE chat_room_member SET role = $3 WHERE room_id = $1 AND user_id = $2", []any{roomId, previousOwnerId, RoomRoleModerator}},
+		{"DELETE FROM chat_room_orphan WHERE room_id = $1", []any{roomId}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement.sql, statement.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (repository *ChatRoomRepository) GetOldestRoomModerator(ctx context.Context, roomId uuid.UUID) (*RoomMember, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT crm.*,
+				   au.user_name
+			FROM   chat_room_member crm
+				   JOIN app_user au
+					 ON crm.user_id = au.id
+			WHERE  crm.room_id = $1 AND crm.role = $2
+			ORDER  BY crm.created_at
+			LIMIT  1`
+		var member RoomMember
+		if err := repository.Engine.Get(&member, sql, roomId, RoomRoleModerator); err != nil {
+			return nil, err
+		}
+		return &member, nil
+	}
+}
+
+// GetOwnerlessRoomIds returns the rooms whose owner account does not exist anymore. Direct conversations
+// have no settings row and are left out, even once the user deletion cascaded to direct_conversation.
+func (repository *ChatRoomRepository) GetOwnerlessRoomIds(ctx context.Context) ([]uuid.UUID, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT cr.id
+			FROM   chat_room cr
+				   LEFT JOIN app_user au
+						  ON cr.owner_id = au.id
+				   JOIN chat_room_settings crs
+					 ON cr.id = crs.room_id
+			WHERE  cr.is_deleted = FALSE AND au.id IS NULL`
+		var roomIds []uuid.UUID
+		if err := repository.Engine.Select(&roomIds, sql); err != nil {
+			return nil, err
+		}
+		return roomIds, nil
+	}
+}
+
+func (repository *ChatRoomRepository) FlagOrphanedRoom(ctx context.Context, roomId uuid.UUID) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := "INSERT INTO chat_room_orphan (room_id) VALUES ($1) ON CONFLICT (room_id) DO NOTHING"
+		_, err := repository.Engine.Exec(sql, roomId)
+		return err
+	}
+}
+
+func (repository *ChatRoomRepository) GetOrphanedRooms(ctx context.Context) ([]OrphanedRoom, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := "SELECT * FROM chat_room_orphan ORDER BY flagged_at"
+		var orphanedRooms []OrphanedRoom
+		if err := repository.Engine.Select(&orphanedRooms, sql); err != nil {
+			return nil, err
+		}
+		return orphanedRooms, nil
+	}
+}
+
+// archivedRoomSql selects soft deleted rooms. Rooms deleted before archiving existed
+// fall back to their last update as archive time.
+const archivedRoomSql = `SELECT cr.*,
+				   crs.room_type,
+				   COALESCE(cra.archived_at, cr.updated_at, cr.created_at) AS archived_at
+			FROM   chat_room cr
+				   JOIN chat_room_settings crs
+					 ON cr.id = crs.room_id
+				   LEFT JOIN chat_room_archive cra
+						  ON cr.id = cra.room_id
+			WHERE  cr.is_deleted = TRUE`
+
+func (repository *ChatRoomRepository) GetArchivedRooms(ctx context.Context, ownerId *int) ([]ArchivedRoom, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := archivedRoomSql + " AND ( $1::INTEGER IS NULL OR cr.owner_id = $1 ) ORDER BY archived_at DESC"
+		var rooms []ArchivedRoom
+		if err := repository.Engine.Select(&rooms, sql, ownerId); err != nil {
+			return nil, err
+		}
+		return rooms, nil
+	}
+}
+
+func (repository *ChatRoomRepository) GetArchivedRoomById(ctx context.Context, roomId uuid.UUID) (*ArchivedRoom, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := archivedRoomSql + " AND cr.id = $1"
+		var room ArchivedRoom
+		if err := repository.Engine.Get(&room, sql, roomId); err != nil {
+			return nil, err
+		}
+		return &room, nil
+	}
+}
+
+func (repository *ChatRoomRepository) RestoreRoom(ctx context.Context, roomId uuid.UUID) error {
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE chat_room SET is_deleted = FALSE, updated_at = NOW() WHERE id = $1", roomId); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chat_room_archive WHERE room_id = $1", roomId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeArchivedRooms permanently deletes the rooms archived before the given time together with
+// their messages and settings. Tables owned by this service are cleaned up by ON DELETE CASCADE.
+func (repository *ChatRoomRepository) PurgeArchivedRooms(ctx context.Context, archivedBefore time.Time) ([]uuid.UUID, error) {
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	selectSql := `SELECT cr.id
+			FROM   chat_room cr
+				   LEFT JOIN chat_room_archive cra
+						  ON cr.id = cra.room_id
+			WHERE  cr.is_deleted = TRUE
+				   AND COALESCE(cra.archived_at, cr.updated_at, cr.created_at) < $1
+			FOR UPDATE OF cr`
+	var roomIds []uuid.UUID
+	if err := tx.SelectContext(ctx, &roomIds, selectSql, archivedBefore); err != nil {
+		return nil, err
+	}
+	if len(roomIds) == 0 {
+		return roomIds, nil
+	}
+
+	for _, sql := range []string{
+		"DELETE FROM chat_message WHERE room_id = ANY($1)",
+		"DELETE FROM chat_room_settings WHERE room_id = ANY($1)",
+		"DELETE FROM chat_room WHERE id = ANY($1)",
+	} {
+		if _, err := tx.ExecContext(ctx, sql, pq.Array(roomIds)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return roomIds, nil
+}
+
+func (repository *ChatRoomRepository) SaveEphemeralRoom(ctx context.Context, roomId uuid.UUID, idleTtlSeconds int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := `INSERT INTO chat_room_ephemeral (room_id, idle_ttl_seconds)
+			VALUES ($1, $2)
+			ON CONFLICT (room_id) DO UPDATE SET idle_ttl_seconds = EXCLUDED.idle_ttl_seconds`
+		_, err := repository.Engine.Exec(sql, roomId, idleTtlSeconds)
+		return err
+	}
+}
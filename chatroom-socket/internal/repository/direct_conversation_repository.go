@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// directConversationNamespace derives a stable room id per user pair, so concurrent first
+// messages of both users end up in the same conversation.
+var directConversationNamespace = uuid.MustParse("fb14c2ef-ca7e-44be-88a1-eea194f273d3")
+
+type IDirectConversationRepository interface {
+	GetOrCreateConversation(ctx context.Context, firstUserId int, secondUserId int) (*DirectConversation, error)
+	GetConversation(ctx context.Context, firstUserId int, secondUserId int) (*DirectConversation, error)
+	GetConversationsByUserId(ctx context.Context, userId int) ([]DirectConversation, error)
+}
+
+type DirectConversationRepository struct {
+	Engine *sqlx.DB
+}
+
+func NewDirectConversationRepository(engine *sqlx.DB) *DirectConversationRepository {
+	return &DirectConversationRepository{Engine: engine}
+}
+
+func orderUserPair(firstUserId int, secondUserId int) (int, int) {
+	if firstUserId > secondUserId {
+		return secondUserId, firstUserId
+	}
+	return firstUserId, secondUserId
+}
+
+// GetOrCreateConversation backs the conversation with a chat_room row without settings,
+// which keeps it out of GetAllRooms while chat_message can still reference it.
+func (repository *DirectConversationRepository) GetOrCreateConversation(ctx context.Context, firstUserId int, secondUserId int) (*DirectConversation, error) {
+	firstUserId, secondUserId = orderUserPair(firstUserId, secondUserId)
+	roomName := fmt.Sprintf("direct:%d:%d", firstUserId, secondUserId)
+	roomId := uuid.NewSHA1(directConversationNamespace, []byte(roomName))
+
+	tx, err := repository.Engine.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	roomSql := `INSERT INTO chat_room (id, name, owner_id, created_at, is_deleted)
+			VALUES ($1, $2, $3, NOW(), FALSE)
+			ON CONFLICT (id) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, roomSql, roomId, roomName, firstUserId); err != nil {
+		return nil, err
+	}
+	conversationSql := `INSERT INTO direct_conversation (room_id, first_user_id, second_user_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (room_id) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, conversationSql, roomId, firstUserId, secondUserId); err != nil {
+		return nil, err
+	}
+	var conversation DirectConversation
+	if err := tx.GetContext(ctx, &conversation, "SELECT * FROM direct_conversation WHERE room_id = $1", roomId); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+func (repository *DirectConversationRepository) GetConversation(ctx context.Context, firstUserId int, secondUserId int) (*DirectConversation, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		firstUserId, secondUserId = orderUserPair(firstUserId, secondUserId)
+		sql := "SELECT * FROM direct_conversation WHERE first_user_id = $1 AND second_user_id = $2"
+		var conversation DirectConversation
+		if err := repository.Engine.Get(&conversation, sql, firstUserId, secondUserId); err != nil {
+			return nil, err
+		}
+		return &conversation, nil
+	}
+}
+
+func (repository *DirectConversationRepository) GetConversationsByUserId(ctx context.Context, userId int) ([]DirectConversation, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT dc.*,
+				   au.id AS other_user_id,
+				   au.user_name AS other_user_name
+			FROM   direct_conversation dc
+				   JOIN app_user au
+					 ON au.id = CASE WHEN dc.first_user_id = $1 THEN dc.second_user_id ELSE dc.first_user_id END
+			WHERE  dc.first_user_id = $1 OR dc.second_user_id = $1
+			ORDER  BY dc.created_at DESC`
+		var conversations []DirectConversation
+		if err := repository.Engine.Select(&conversations, sql, userId); err != nil {
+			return nil, err
+		}
+		return conversations, nil
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type IMentionRepository interface {
+	GetRoomMemberIdsByName(ctx context.Context, roomId uuid.UUID, userNames []string) ([]int, error)
+	SaveMentions(ctx context.Context, mentions []Mention) error
+	GetUnreadMentions(ctx context.Context, userId int, limit uint) ([]UnreadMention, error)
+	MarkMentionsRead(ctx context.Context, userId int, roomId uuid.UUID, readUntil time.Time) error
+}
+
+type MentionRepository struct {
+	Engine *sqlx.DB
+}
+
+func NewMentionRepository(engine *sqlx.DB) *MentionRepository {
+	return &MentionRepository{Engine: engine}
+}
+
+// GetRoomMemberIdsByName resolves user names against app_user, keeping only the members of the room.
+func (repository *MentionRepository) GetRoomMemberIdsByName(ctx context.Context, roomId uuid.UUID, userNames []string) ([]int, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT au.id FROM app_user au
+			JOIN chat_room_member crm ON crm.user_id = au.id AND crm.room_id = $1
+			WHERE au.user_name = ANY($2)`
+		var userIds []int
+		if err := repository.Engine.SelectContext(ctx, &userIds, sql, roomId, pq.Array(userNames)); err != nil {
+			return nil, err
+		}
+		return userIds, nil
+	}
+}
+
+func (repository *MentionRepository) SaveMentions(ctx context.Context, mentions []Mention) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if len(mentions) == 0 {
+			return nil
+		}
+		sql := `INSERT INTO chat_message_mention (message_id, user_id, room_id, mention_type)
+			VALUES (:message_id, :user_id, :room_id, :mention_type)
+			ON CONFLICT (message_id, user_id) DO NOTHING`
+		_, err := repository.Engine.NamedExecContext(ctx, sql, mentions)
+		return err
+	}
+}
+
+// GetUnreadMentions returns the unread mentions of the user, latest first. Mentions in deleted messages are skipped.
+func (repository *MentionRepository) GetUnreadMentions(ctx context.Context, userId int, limit uint) ([]UnreadMention, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := `SELECT mention.*, message.content, message.sender_id
+			FROM chat_message_mention mention
+			JOIN chat_message message ON message.id = mention.message_id
+			LEFT JOIN chat_message_deletion deletion ON deletion.message_id = mention.message_id
+			WHERE mention.user_id = $1 AND mention.read_at IS NULL AND deletion.message_id IS NULL
+			ORDER BY mention.created_at DESC
+			LIMIT $2`
+		mentions := make([]UnreadMention, 0)
+		if err := repository.Engine.SelectContext(ctx, &mentions, sql, userId, limit); err != nil {
+			return nil, err
+		}
+		return mentions, nil
+	}
+}
+
+// MarkMentionsRead marks the mentions of the user in the room up to readUntil as read.
+func (repository *MentionRepository) MarkMentionsRead(ctx context.Context, userId int, roomId uuid.UUID, readUntil time.Time) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := `UPDATE chat_message_mention mention SET read_at = NOW()
+			FROM chat_message message
+			WHERE message.id = mention.message_id
+				AND mention.user_id = $1 AND mention.room_id = $2 AND mention.read_at IS NULL
+				AND message.created_at <= $3`
+		_, err := repository.Engine.ExecContext(ctx, sql, userId, roomId, readUntil)
+		return err
+	}
+}
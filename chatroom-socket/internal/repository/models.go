@@ -9,6 +9,12 @@ type ChatMessageType string
 
 type RoomType string
 
+type RoomRole string
+
+type SanctionType string
+
+type RoomJoinMethod string
+
 const (
 	AssistantMessageType ChatMessageType = "assistant" // Message from the assistant.
 	HumanMessageType     ChatMessageType = "human"     // Message from the human user.
@@ -19,6 +25,35 @@ const (
 	RoomTypePrivate RoomType = "private"
 )
 
+const (
+	UserRoleAdmin = "admin"
+)
+
+type MentionType string
+
+const (
+	MentionTypeUser MentionType = "user" // @user_name
+	MentionTypeRoom MentionType = "room" // @room reaches every member of the room.
+	MentionTypeHere MentionType = "here" // @here reaches the members who are online.
+)
+
+const (
+	RoomRoleOwner     RoomRole = "owner" // Derived from Room.OwnerId, never stored on a member.
+	RoomRoleModerator RoomRole = "moderator"
+	RoomRoleMember    RoomRole = "member"
+)
+
+const (
+	RoomJoinDirect   RoomJoinMethod = "direct"   // Public room, room owner or a user invited by the owner.
+	RoomJoinInvite   RoomJoinMethod = "invite"   // Invite code.
+	RoomJoinPassword RoomJoinMethod = "password" // Revoked when the room password changes.
+)
+
+const (
+	SanctionTypeBan  SanctionType = "ban"
+	SanctionTypeMute SanctionType = "mute"
+)
+
 // User represents a user of the system with necessary details and metadata.
 type User struct {
 	ID         int    `db:"id" json:"id"`                   // Primary key, auto-incremented integer.
@@ -29,23 +64,143 @@ type User struct {
 	IsVerified bool   `db:"is_verified" json:"is_verified"` // Verification status, defaults to false.
 }
 
+func (user *User) IsAdmin() bool {
+	return user.Role == UserRoleAdmin
+}
+
 type ChatRoomSettings struct {
-	ID            uuid.UUID `json:"id"`
-	RoomID        uuid.UUID `json:"room_id"` // Foreign key referencing the Room ID.
-	AssistantRule string    `json:"assistant_rule"`
-	RoomType      RoomType  `json:"room_type"`
-	Password      *string   `json:"-"`
+	ID            uuid.UUID `json:"id" db:"id"`
+	RoomID        uuid.UUID `json:"room_id" db:"room_id"` // Foreign key referencing the Room ID.
+	AssistantRule string    `json:"assistant_rule" db:"assistant_rule"`
+	RoomType      RoomType  `json:"room_type" db:"room_type"`
+	Password      *string   `json:"-" db:"password"` // Salted bcrypt hash, never exposed. Rooms of the admin service may still hold plaintext.
 }
 
 type Room struct {
 	ID        uuid.UUID        `json:"id" db:"id"`
 	Name      string           `json:"name" db:"name"`
-	OwnerId   int              `json:"owner_id" db:"owner_id"`
+	OwnerId   *int             `json:"owner_id" db:"owner_id"` // Nil once the owner account is deleted.
 	CreatedAt time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt *time.Time       `json:"updated_at" db:"updated_at"`
 	IsDeleted bool             `json:"is_deleted" db:"is_deleted"`
 	RoomType  RoomType         `json:"room_type" db:"room_type"`
 	Settings  ChatRoomSettings `json:"settings" db:"-"` // Defines one-to-one relationship
+	// IdleTtlSeconds is only set for ephemeral rooms.
+	IdleTtlSeconds *int `json:"idle_ttl_seconds" db:"idle_ttl_seconds"`
+}
+
+func (room *Room) IsOwnedBy(userId int) bool {
+	return room.OwnerId != nil && *room.OwnerId == userId
+}
+
+// RoomMember is a persisted membership of a user in a room that survives reconnects.
+type RoomMember struct {
+	RoomId     uuid.UUID      `db:"room_id" json:"room_id"`
+	UserId     int            `db:"user_id" json:"user_id"`
+	UserName   string         `db:"user_name" json:"user_name"`
+	Role       RoomRole       `db:"role" json:"role"`
+	InvitedBy  *int           `db:"invited_by" json:"invited_by"` // Nil when the user joined by themselves.
+	JoinMethod RoomJoinMethod `db:"join_method" json:"join_method"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+}
+
+// RoomSanction is a ban or mute of a user in a room. A nil ExpiresAt lasts until it is lifted.
+type RoomSanction struct {
+	RoomId       uuid.UUID    `db:"room_id" json:"room_id"`
+	UserId       int          `db:"user_id" json:"user_id"`
+	SanctionType SanctionType `db:"sanction_type" json:"sanction_type"`
+	IssuedBy     int          `db:"issued_by" json:"issued_by"`
+	Reason       string       `db:"reason" json:"reason"`
+	ExpiresAt    *time.Time   `db:"expires_at" json:"expires_at"`
+	CreatedAt    time.Time    `db:"created_at" json:"created_at"`
+}
+
+// RoomInvite is an invite code for a room. MaxUses of 0 means unlimited and a nil ExpiresAt never expires.
+type RoomInvite struct {
+	Code      string     `db:"code" json:"code"`
+	RoomId    uuid.UUID  `db:"room_id" json:"room_id"`
+	CreatedBy int        `db:"created_by" json:"created_by"`
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at"`
+	MaxUses   int        `db:"max_uses" json:"max_uses"`
+	Uses      int        `db:"uses" json:"uses"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// ArchivedRoom is a soft deleted room that can be restored until it is purged.
+type ArchivedRoom struct {
+	Room
+	ArchivedAt time.Time `json:"archived_at" db:"archived_at"`
+}
+
+// OrphanedRoom is a room whose owner account is gone and that no moderator could take over.
+type OrphanedRoom struct {
+	RoomId    uuid.UUID `db:"room_id" json:"room_id"`
+	FlaggedAt time.Time `db:"flagged_at" json:"flagged_at"`
+}
+
+// DirectConversation is a 1:1 conversation whose messages are stored under RoomId like any room.
+// FirstUserId is always the lower user id of the pair.
+type DirectConversation struct {
+	RoomId        uuid.UUID `db:"room_id" json:"room_id"`
+	FirstUserId   int       `db:"first_user_id" json:"first_user_id"`
+	SecondUserId  int       `db:"second_user_id" json:"second_user_id"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	OtherUserId   int       `db:"other_user_id" json:"other_user_id,omitempty"`     // Only set when listing the conversations of a user.
+	OtherUserName string    `db:"other_user_name" json:"other_user_name,omitempty"` // Only set when listing the conversations of a user.
+}
+
+func (conversation *DirectConversation) HasParticipant(userId int) bool {
+	return conversation.FirstUserId == userId || conversation.SecondUserId == userId
+}
+
+// ReadMarker is the latest message a user has read in a room. LastReadAt is the creation time
+// of that message, so it only moves forward.
+type ReadMarker struct {
+	RoomId            uuid.UUID `db:"room_id" json:"room_id"`
+	UserId            int       `db:"user_id" json:"user_id"`
+	LastReadMessageId *string   `db:"last_read_message_id" json:"last_read_message_id"`
+	LastReadAt        time.Time `db:"last_read_at" json:"last_read_at"`
+}
+
+type UnreadCount struct {
+	RoomId      uuid.UUID  `db:"room_id" json:"room_id"`
+	UnreadCount int        `db:"unread_count" json:"unread_count"`
+	LastReadAt  *time.Time `db:"last_read_at" json:"last_read_at"` // Nil when the user never read the room.
+}
+
+// UserPresence is the persisted part of the presence of a user. LastSeenAt is set when their last connection closes.
+type UserPresence struct {
+	UserId     int        `db:"user_id" json:"user_id"`
+	StatusText string     `db:"status_text" json:"status_text"`
+	LastSeenAt *time.Time `db:"last_seen_at" json:"last_seen_at"`
+}
+
+// Mention records that a message mentioned a user. ReadAt stays nil until the user reads the room past the message.
+type Mention struct {
+	MessageId   string      `db:"message_id" json:"message_id"`
+	UserId      int         `db:"user_id" json:"user_id"`
+	RoomId      uuid.UUID   `db:"room_id" json:"room_id"`
+	MentionType MentionType `db:"mention_type" json:"mention_type"`
+	CreatedAt   time.Time   `db:"created_at" json:"created_at"`
+	ReadAt      *time.Time  `db:"read_at" json:"read_at"`
+}
+
+type UnreadMention struct {
+	Mention
+	Content  string `db:"content" json:"content"`
+	SenderId int    `db:"sender_id" json:"sender_id"`
+}
+
+type ChatMessagePin struct {
+	MessageId string    `db:"message_id" json:"message_id"`
+	RoomId    uuid.UUID `db:"room_id" json:"room_id"`
+	PinnedBy  int       `db:"pinned_by" json:"pinned_by"`
+	PinnedAt  time.Time `db:"pinned_at" json:"pinned_at"`
+}
+
+type PinnedMessage struct {
+	ChatMessagePin
+	Message *ChatMessage `json:"message"`
 }
 
 // ChatMessage represents a message within a chat room.
@@ -58,4 +213,34 @@ type ChatMessage struct {
 	UpdatedAt   *time.Time      `db:"updated_at" json:"updated_at"`     // Timestamp of the last update (nullable).
 	MessageType ChatMessageType `db:"message_type" json:"message_type"` // Type of message (e.g., assistant, human).
 	IsCommitted bool            `db:"-" json:"is_committed"`            // Message commit status, defaults to false (excluded from database).
+	IsDeleted   bool            `db:"is_deleted" json:"is_deleted"`     // Tombstone of a deleted message, its content is emptied.
+	Reactions   []ReactionCount `db:"-" json:"reactions"`               // Reaction counts per emoji, in the order they were first added.
+	ParentId    *string         `db:"parent_id" json:"parent_id"`       // Message this one replies to. Threads are one level deep.
+	ReplyCount  int             `db:"reply_count" json:"reply_count"`
+	LastReplyAt *time.Time      `db:"last_reply_at" json:"last_reply_at"`
+}
+
+type ReactionCount struct {
+	Emoji string `db:"emoji" json:"emoji"`
+	Count int    `db:"count" json:"count"`
+}
+
+type MessageReactionStats struct {
+	EmojiCount     int  `db:"emoji_count"`      // Distinct emojis on the message.
+	UserEmojiCount int  `db:"user_emoji_count"` // Emojis the user put on the message.
+	HasEmoji       bool `db:"has_emoji"`        // Someone already reacted with the emoji.
+	HasReacted     bool `db:"has_reacted"`      // The user already reacted with the emoji.
+}
+
+type ReactionLimits struct {
+	MaxEmojisPerMessage int
+	MaxPerUser          int
+}
+
+// ChatMessageEdit keeps the content a message had before one of its edits.
+type ChatMessageEdit struct {
+	MessageId       string    `db:"message_id" json:"message_id"`
+	PreviousContent string    `db:"previous_content" json:"previous_content"`
+	EditedBy        int       `db:"edited_by" json:"edited_by"`
+	EditedAt        time.Time `db:"edited_at" json:"edited_at"`
 }
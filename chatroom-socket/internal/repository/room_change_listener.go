@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"log"
+	"time"
+)
+
+const RoomChangedChannel = "chat_room_changed"
+
+// RoomChangeListener receives the notifications sent by the chat_room and chat_room_settings
+// triggers, so that changes made by the admin service reach the room cache.
+type RoomChangeListener struct {
+	listener *pq.Listener
+}
+
+func NewRoomChangeListener(connectionUrl string) (*RoomChangeListener, error) {
+	reportProblem := func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("room change listener error:", err)
+		}
+	}
+	listener := pq.NewListener(connectionUrl, time.Second, time.Minute, reportProblem)
+	if err := listener.Listen(RoomChangedChannel); err != nil {
+		return nil, err
+	}
+	return &RoomChangeListener{listener: listener}, nil
+}
+
+// RoomChanges emits the id of every changed room. uuid.Nil is emitted after a reconnect
+// because notifications may have been missed and everything has to be reconciled.
+func (roomChangeListener *RoomChangeListener) RoomChanges(ctx context.Context) <-chan uuid.UUID {
+	roomIds := make(chan uuid.UUID)
+	go func() {
+		defer close(roomIds)
+		defer roomChangeListener.listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification := <-roomChangeListener.listener.Notify:
+				roomId := uuid.Nil
+				if notification != nil {
+					parsedRoomId, err := uuid.Parse(notification.Extra)
+					if err != nil {
+						log.Println("invalid room change notification:", notification.Extra)
+						continue
+					}
+					roomId = parsedRoomId
+				}
+				select {
+				case roomIds <- roomId:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return roomIds
+}
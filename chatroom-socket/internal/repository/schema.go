@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+	"log"
+)
+
+// schemaStatements creates the tables owned by the socket service.
+// chat_room, chat_room_settings, chat_message and app_user are owned by the admin service.
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS chat_room_member (
+		room_id    UUID NOT NULL REFERENCES chat_room (id) ON DELETE CASCADE,
+		user_id    INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		invited_by INTEGER,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (room_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_room_member_user_id ON chat_room_member (user_id)`,
+	`CREATE TABLE IF NOT EXISTS chat_room_invite (
+		code       TEXT PRIMARY KEY,
+		room_id    UUID NOT NULL REFERENCES chat_room (id) ON DELETE CASCADE,
+		created_by INTEGER NOT NULL,
+		expires_at TIMESTAMPTZ,
+		max_uses   INTEGER NOT NULL DEFAULT 0,
+		uses       INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_room_invite_room_id ON chat_room_invite (room_id)`,
+	`ALTER TABLE chat_room_member ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member'`,
+	`CREATE TABLE IF NOT EXISTS chat_room_sanction (
+		room_id       UUID NOT NULL REFERENCES chat_room (id) ON DELETE CASCADE,
+		user_id       INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		sanction_type TEXT NOT NULL,
+		issued_by     INTEGER NOT NULL,
+		reason        TEXT NOT NULL DEFAULT '',
+		expires_at    TIMESTAMPTZ,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (room_id, user_id, sanction_type)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_room_orphan (
+		room_id    UUID PRIMARY KEY REFERENCES chat_room (id) ON DELETE CASCADE,
+		flagged_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_room_archive (
+		room_id     UUID PRIMARY KEY REFERENCES chat_room (id) ON DELETE CASCADE,
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_room_ephemeral (
+		room_id          UUID PRIMARY KEY REFERENCES chat_room (id) ON DELETE CASCADE,
+		idle_ttl_seconds INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS direct_conversation (
+		room_id        UUID PRIMARY KEY REFERENCES chat_room (id) ON DELETE CASCADE,
+		first_user_id  INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		second_user_id INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (first_user_id, second_user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS direct_conversation_second_user_id ON direct_conversation (second_user_id)`,
+	`CREATE OR REPLACE FUNCTION notify_chat_room_changed() RETURNS TRIGGER AS $$
+	DECLARE
+		changed_row RECORD;
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			changed_row := OLD;
+		ELSE
+			changed_row := NEW;
+		END IF;
+		IF TG_TABLE_NAME = 'chat_room' THEN
+			PERFORM pg_notify('` + RoomChangedChannel + `', changed_row.id::TEXT);
+		ELSE
+			PERFORM pg_notify('` + RoomChangedChannel + `', changed_row.room_id::TEXT);
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS chat_room_changed ON chat_room`,
+	`CREATE TRIGGER chat_room_changed AFTER INSERT OR UPDATE OR DELETE ON chat_room
+		FOR EACH ROW EXECUTE PROCEDURE notify_chat_room_changed()`,
+	`DROP TRIGGER IF EXISTS chat_room_settings_changed ON chat_room_settings`,
+	`CREATE TRIGGER chat_room_settings_changed AFTER INSERT OR UPDATE OR DELETE ON chat_room_settings
+		FOR EACH ROW EXECUTE PROCEDURE notify_chat_room_changed()`,
+	`CREATE TABLE IF NOT EXISTS chat_room_read_marker (
+		room_id              UUID NOT NULL REFERENCES chat_room (id) ON DELETE CASCADE,
+		user_id              INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		last_read_message_id UUID REFERENCES chat_message (id) ON DELETE SET NULL,
+		last_read_at         TIMESTAMPTZ NOT NULL,
+		updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (room_id, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_presence (
+		user_id      INTEGER PRIMARY KEY REFERENCES app_user (id) ON DELETE CASCADE,
+		status_text  TEXT NOT NULL DEFAULT '',
+		last_seen_at TIMESTAMPTZ,
+		updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_message_edit (
+		id               BIGSERIAL PRIMARY KEY,
+		message_id       UUID NOT NULL REFERENCES chat_message (id) ON DELETE CASCADE,
+		previous_content TEXT NOT NULL,
+		edited_by        INTEGER NOT NULL,
+		edited_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_message_edit_message_id ON chat_message_edit (message_id)`,
+	`CREATE TABLE IF NOT EXISTS chat_message_deletion (
+		message_id UUID PRIMARY KEY REFERENCES chat_message (id) ON DELETE CASCADE,
+		deleted_by INTEGER NOT NULL,
+		deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_message_reaction (
+		message_id UUID NOT NULL REFERENCES chat_message (id) ON DELETE CASCADE,
+		user_id    INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		emoji      TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (message_id, user_id, emoji)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_message_thread (
+		message_id UUID PRIMARY KEY REFERENCES chat_message (id) ON DELETE CASCADE,
+		parent_id  UUID NOT NULL REFERENCES chat_message (id) ON DELETE CASCADE
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_message_thread_parent_id ON chat_message_thread (parent_id)`,
+	`CREATE TABLE IF NOT EXISTS chat_message_mention (
+		message_id   UUID NOT NULL REFERENCES chat_message (id) ON DELETE CASCADE,
+		user_id      INTEGER NOT NULL REFERENCES app_user (id) ON DELETE CASCADE,
+		room_id      UUID NOT NULL REFERENCES chat_room (id) ON DELETE CASCADE,
+		mention_type TEXT NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		read_at      TIMESTAMPTZ,
+		PRIMARY KEY (message_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_message_mention_unread ON chat_message_mention (user_id) WHERE read_at IS NULL`,
+	`CREATE TABLE IF NOT EXISTS chat_message_pin (
+		message_id UUID PRIMARY KEY REFERENCES chat_message (id) ON DELETE CASCADE,
+		room_id    UUID NOT NULL REFERENCES chat_room (id) ON DELETE CASCADE,
+		pinned_by  INTEGER NOT NULL,
+		pinned_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_message_pin_room_id ON chat_message_pin (room_id)`,
+	`ALTER TABLE chat_room_member ADD COLUMN IF NOT EXISTS join_method TEXT NOT NULL DEFAULT 'direct'`,
+}
+
+func CreateTables(engine *sqlx.DB) error {
+	for _, statement := range schemaStatements {
+		if _, err := engine.Exec(statement); err != nil {
+			log.Println("unable to create table:", statement)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+type IUserPresenceRepository interface {
+	GetUserPresences(ctx context.Context, userIds []int) ([]UserPresence, error)
+	SaveLastSeen(ctx context.Context, userId int, lastSeenAt time.Time) error
+	SaveStatusText(ctx context.Context, userId int, statusText string) error
+}
+
+type UserPresenceRepository struct {
+	Engine *sqlx.DB
+}
+
+func NewUserPresenceRepository(engine *sqlx.DB) *UserPresenceRepository {
+	return &UserPresenceRepository{Engine: engine}
+}
+
+func (repository *UserPresenceRepository) GetUserPresences(ctx context.Context, userIds []int) ([]UserPresence, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		sql := "SELECT user_id, status_text, last_seen_at FROM user_presence WHERE user_id = ANY($1)"
+		presences := make([]UserPresence, 0, len(userIds))
+		if err := repository.Engine.SelectContext(ctx, &presences, sql, pq.Array(userIds)); err != nil {
+			return nil, err
+		}
+		return presences, nil
+	}
+}
+
+func (repository *UserPresenceRepository) SaveLastSeen(ctx context.Context, userId int, lastSeenAt time.Time) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := `INSERT INTO user_presence (user_id, last_seen_at) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at, updated_at = NOW()`
+		_, err := repository.Engine.ExecContext(ctx, sql, userId, lastSeenAt)
+		return err
+	}
+}
+
+func (repository *UserPresenceRepository) SaveStatusText(ctx context.Context, userId int, statusText string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		sql := `INSERT INTO user_presence (user_id, status_text) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET status_text = EXCLUDED.status_text, updated_at = NOW()`
+		_, err := repository.Engine.ExecContext(ctx, sql, userId, statusText)
+		return err
+	}
+}
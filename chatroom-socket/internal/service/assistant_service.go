@@ -2,9 +2,12 @@ package service
 
 import (
 	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"log"
+	"time"
 )
 
 const (
@@ -44,3 +47,16 @@ func (service *AssistantService) GetAssistantUser() (*User, error) {
 	}
 	return &user, nil
 }
+
+func (service *AssistantService) RegisterSocketEvents(registry *SocketEventRegistry) error {
+	sendAssistantMessage := NewSocketEventHandler(EventSendAssistantChatMessage, service.handleEventSendAssistantMessage)
+	sendAssistantMessage.RateLimit = RateLimit{Count: 20, Window: 10 * time.Second}
+	return registry.Register(sendAssistantMessage)
+}
+
+// handleEventSendAssistantMessage accepts the event and drops it, as before the event registry. The
+// assistant does not answer over the socket yet.
+func (service *AssistantService) handleEventSendAssistantMessage(ctx context.Context, user User, payload *json.RawMessage) error {
+	log.Println(fmt.Sprintf("ignoring assistant message of user %v, the assistant is not available over the socket", user.ID))
+	return nil
+}
@@ -4,37 +4,46 @@ import (
 	. "chatroom-socket/internal/repository"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
 	"net/http"
-	"slices"
+	"time"
 )
 
 type ChatMessageService struct {
 	RoomService           *RoomService
 	httpClient            *http.Client
 	chatMessageRepository IChatMessageRepository
+	mentionRepository     IMentionRepository
+	reactionRateLimiter   *RateLimiter
 }
 
-func NewChatMessageService(roomService *RoomService, messageRepository IChatMessageRepository) *ChatMessageService {
-	return &ChatMessageService{RoomService: roomService, httpClient: http.DefaultClient, chatMessageRepository: messageRepository}
-}
-
-func (service *ChatMessageService) GetAllMessagesByRoomId(roomId uuid.UUID, offset uint, limit uint) ([]*ChatMessage, error) {
-	return service.chatMessageRepository.GetAllMessagesByRoomId(roomId, offset, limit)
+func NewChatMessageService(roomService *RoomService, messageRepository IChatMessageRepository, mentionRepository IMentionRepository) *ChatMessageService {
+	return &ChatMessageService{
+		RoomService:           roomService,
+		httpClient:            http.DefaultClient,
+		chatMessageRepository: messageRepository,
+		mentionRepository:     mentionRepository,
+		reactionRateLimiter:   NewRateLimiter(),
+	}
 }
 
-func (service *ChatMessageService) GetValidEventTypes() []string {
-	return []string{
-		string(EventSendRegularMessage),
-		string(EventSendAssistantChatMessage),
+func (service *ChatMessageService) broadcastRoomMessage(room *SocketRoom, message *ChatMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
 	}
+	room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, string(body)))
+	return nil
 }
 
-func (service *ChatMessageService) IsValidEventType(event EventType) bool {
-	return slices.Contains(service.GetValidEventTypes(), string(event))
+func (service *ChatMessageService) GetAllMessagesByRoomId(roomId uuid.UUID, offset uint, limit uint) ([]*ChatMessage, error) {
+	return service.chatMessageRepository.GetAllMessagesByRoomId(roomId, offset, limit)
 }
 
-func (service *ChatMessageService) SendMessageToRoomId(ctx context.Context, senderId int, content string) (*ChatMessage, error) {
+// SendMessageToRoomId sends a message to the room of the sender. A non-nil parentId makes it a reply
+// in the thread of that message.
+func (service *ChatMessageService) SendMessageToRoomId(ctx context.Context, senderId int, content string, parentId *string) (*ChatMessage, error) {
 	roomId, err := service.RoomService.GetUserLocation(senderId)
 	if err != nil {
 		return nil, err
@@ -44,22 +53,42 @@ func (service *ChatMessageService) SendMessageToRoomId(ctx context.Context, send
 	if err != nil {
 		return nil, err
 	}
+	if mutedUntil, isMuted := room.Moderation.MutedUntil(senderId); isMuted {
+		return nil, fmt.Errorf("%w until %v", ErrUserMuted, mutedUntil.Format(time.RFC3339))
+	}
 
 	message, err := NewChatMessage(roomId, senderId, content)
 	if err != nil {
 		return nil, err
 	}
-
-	body, err := json.Marshal(message)
-	if err != nil {
-		return nil, err
+	if parentId != nil {
+		threadId, err := service.getThreadId(ctx, room, *parentId)
+		if err != nil {
+			return nil, err
+		}
+		message.ParentId = &threadId
 	}
 
-	room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, string(body)))
+	// Replies are only broadcast once saved and filed in their thread, other messages go out right away.
+	if message.ParentId == nil {
+		if err := service.broadcastRoomMessage(room, message); err != nil {
+			return nil, err
+		}
+	}
 	message, err = service.chatMessageRepository.SaveMessageToRoomId(ctx, message)
 	if err != nil {
 		return nil, err
 	}
+	if message.ParentId != nil {
+		if err := service.broadcastRoomMessage(room, message); err != nil {
+			return nil, err
+		}
+	}
+	service.notifyMessageCommitted(message)
+	service.recordMentions(ctx, room, message)
+	if message.ParentId != nil {
+		service.notifyThreadParticipants(ctx, message)
+	}
 	return message, nil
 
 }
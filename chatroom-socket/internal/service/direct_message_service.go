@@ -0,0 +1,76 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// DirectMessageService delivers 1:1 messages straight to the sockets of both participants,
+// regardless of the room they are currently in.
+type DirectMessageService struct {
+	SocketService                *SocketService
+	chatMessageRepository        IChatMessageRepository
+	directConversationRepository IDirectConversationRepository
+}
+
+func NewDirectMessageService(socketService *SocketService, messageRepository IChatMessageRepository, conversationRepository IDirectConversationRepository) *DirectMessageService {
+	return &DirectMessageService{
+		SocketService:                socketService,
+		chatMessageRepository:        messageRepository,
+		directConversationRepository: conversationRepository,
+	}
+}
+
+func (service *DirectMessageService) SendDirectMessage(ctx context.Context, sender User, recipientId int, content string) (*ChatMessage, error) {
+	if recipientId == 0 {
+		return nil, errors.New("recipient_id is required")
+	}
+	if recipientId == sender.ID {
+		return nil, errors.New("user can't send direct message to themselves")
+	}
+	conversation, err := service.directConversationRepository.GetOrCreateConversation(ctx, sender.ID, recipientId)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := NewChatMessage(conversation.RoomId, sender.ID, content)
+	if err != nil {
+		return nil, err
+	}
+	message, err = service.chatMessageRepository.SaveMessageToRoomId(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	socketMessage := NewSocketMessage(EventDirectMessage, string(body))
+	for _, userId := range []int{recipientId, sender.ID} {
+		if err := service.SocketService.SendMessageToUser(userId, socketMessage); err != nil {
+			log.Println(fmt.Sprintf("direct message not delivered to user %v: %v", userId, err))
+		}
+	}
+	return message, nil
+}
+
+func (service *DirectMessageService) GetConversations(ctx context.Context, userId int) ([]DirectConversation, error) {
+	return service.directConversationRepository.GetConversationsByUserId(ctx, userId)
+}
+
+func (service *DirectMessageService) GetDirectMessages(ctx context.Context, userId int, otherUserId int, offset uint, limit uint) ([]*ChatMessage, error) {
+	conversation, err := service.directConversationRepository.GetConversation(ctx, userId, otherUserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []*ChatMessage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return service.chatMessageRepository.GetAllMessagesByRoomId(conversation.RoomId, offset, limit)
+}
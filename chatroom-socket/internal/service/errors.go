@@ -0,0 +1,84 @@
+package service
+
+import "errors"
+
+type ErrorCode string
+
+const (
+	CodeRoomNotFound            ErrorCode = "room_not_found"
+	CodeRoomNotReady            ErrorCode = "room_not_ready"
+	CodeRoomPasswordRequired    ErrorCode = "room_password_required"
+	CodeWrongRoomPassword       ErrorCode = "wrong_room_password"
+	CodeTooManyPasswordAttempts ErrorCode = "too_many_password_attempts"
+	CodeNotRoomOwner            ErrorCode = "not_room_owner"
+	CodeNotRoomMember           ErrorCode = "not_room_member"
+	CodeInviteNotFound          ErrorCode = "invite_not_found"
+	CodeInviteExpired           ErrorCode = "invite_expired"
+	CodeInviteExhausted         ErrorCode = "invite_exhausted"
+	CodeInsufficientRoomRole    ErrorCode = "insufficient_room_role"
+	CodeUserBanned              ErrorCode = "user_banned"
+	CodeUserMuted               ErrorCode = "user_muted"
+	CodeAdminRequired           ErrorCode = "admin_required"
+	CodeInvalidMessage          ErrorCode = "invalid_message"
+	CodeSessionNotFound         ErrorCode = "session_not_found"
+	CodeUnknownEvent            ErrorCode = "unknown_event"
+	CodeRateLimited             ErrorCode = "rate_limited"
+	CodeMessageNotFound         ErrorCode = "message_not_found"
+	CodeNotMessageSender        ErrorCode = "not_message_sender"
+	CodeMessageDeleted          ErrorCode = "message_deleted"
+	CodeReactionLimitReached    ErrorCode = "reaction_limit_reached"
+	CodePinLimitReached         ErrorCode = "pin_limit_reached"
+	CodeUserNotFound            ErrorCode = "user_not_found"
+	CodeRequestFailed           ErrorCode = "request_failed" // Any socket request failure without a more specific code.
+)
+
+// ServiceError carries a machine-readable code so that clients can tell failures apart
+// without parsing the message. Wrap it with fmt.Errorf("%w") to add context.
+type ServiceError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (err *ServiceError) Error() string {
+	return err.Message
+}
+
+func NewServiceError(code ErrorCode, message string) *ServiceError {
+	return &ServiceError{Code: code, Message: message}
+}
+
+var (
+	ErrRoomNotFound            = NewServiceError(CodeRoomNotFound, "room not found")
+	ErrRoomNotReady            = NewServiceError(CodeRoomNotReady, "room is still loading, please try again shortly")
+	ErrRoomPasswordRequired    = NewServiceError(CodeRoomPasswordRequired, "room password is required for private room")
+	ErrWrongRoomPassword       = NewServiceError(CodeWrongRoomPassword, "wrong room password")
+	ErrTooManyPasswordAttempts = NewServiceError(CodeTooManyPasswordAttempts, "too many wrong password attempts, please try again later")
+	ErrNotRoomOwner            = NewServiceError(CodeNotRoomOwner, "user is not the owner of the room")
+	ErrNotRoomMember           = NewServiceError(CodeNotRoomMember, "user is not a member of the room")
+	ErrInviteNotFound          = NewServiceError(CodeInviteNotFound, "invite code not found")
+	ErrInviteExpired           = NewServiceError(CodeInviteExpired, "invite code is expired")
+	ErrInviteExhausted         = NewServiceError(CodeInviteExhausted, "invite code has no uses left")
+	ErrInsufficientRoomRole    = NewServiceError(CodeInsufficientRoomRole, "user role in the room is not sufficient")
+	ErrUserBanned              = NewServiceError(CodeUserBanned, "user is banned from the room")
+	ErrUserMuted               = NewServiceError(CodeUserMuted, "user is muted in the room")
+	ErrAdminRequired           = NewServiceError(CodeAdminRequired, "only admins can do this")
+	ErrInvalidMessage          = NewServiceError(CodeInvalidMessage, "invalid message format")
+	ErrSessionNotFound         = NewServiceError(CodeSessionNotFound, "session not found or expired")
+	ErrUnknownEvent            = NewServiceError(CodeUnknownEvent, "unknown event")
+	ErrRateLimited             = NewServiceError(CodeRateLimited, "too many requests, please slow down")
+	ErrMessageNotFound         = NewServiceError(CodeMessageNotFound, "message not found")
+	ErrNotMessageSender        = NewServiceError(CodeNotMessageSender, "user is not the sender of the message")
+	ErrMessageDeleted          = NewServiceError(CodeMessageDeleted, "message is deleted")
+	ErrReactionLimitReached    = NewServiceError(CodeReactionLimitReached, "too many reactions on the message")
+	ErrPinLimitReached         = NewServiceError(CodePinLimitReached, "too many pinned messages in the room")
+	ErrUserNotFound            = NewServiceError(CodeUserNotFound, "user not found")
+)
+
+// GetErrorCode returns the code of the first ServiceError in the chain of err, or an empty code.
+func GetErrorCode(err error) ErrorCode {
+	var serviceError *ServiceError
+	if errors.As(err, &serviceError) {
+		return serviceError.Code
+	}
+	return ""
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"sync"
+	"testing"
+	"time"
+)
+
+type roomMemberKey struct {
+	RoomId uuid.UUID
+	UserId int
+}
+
+// fakeChatRoomRepository keeps rooms in memory. Methods that aren't overridden panic on the nil interface.
+type fakeChatRoomRepository struct {
+	IChatRoomRepository
+	rooms    map[uuid.UUID]*Room
+	settings map[uuid.UUID]*ChatRoomSettings
+	members  map[roomMemberKey]*RoomMember
+	invites  map[string]*RoomInvite
+	userIds  map[int]bool
+	lock     *sync.Mutex
+}
+
+func newFakeChatRoomRepository() *fakeChatRoomRepository {
+	return &fakeChatRoomRepository{
+		rooms:    make(map[uuid.UUID]*Room),
+		settings: make(map[uuid.UUID]*ChatRoomSettings),
+		members:  make(map[roomMemberKey]*RoomMember),
+		invites:  make(map[string]*RoomInvite),
+		userIds:  make(map[int]bool),
+		lock:     new(sync.Mutex),
+	}
+}
+
+func (repository *fakeChatRoomRepository) GetRoomById(ctx context.Context, roomId uuid.UUID) (*Room, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	room, ok := repository.rooms[roomId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *room
+	return &copied, nil
+}
+
+func (repository *fakeChatRoomRepository) UpdateRoomSettings(ctx context.Context, roomId uuid.UUID, name string, settings *ChatRoomSettings) error {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	if room, ok := repository.rooms[roomId]; ok {
+		room.Name, room.RoomType = name, settings.RoomType
+	}
+	copied := *settings
+	repository.settings[roomId] = &copied
+	return nil
+}
+
+func (repository *fakeChatRoomRepository) GetRoomSettings(ctx context.Context, roomId uuid.UUID) (*ChatRoomSettings, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	settings, ok := repository.settings[roomId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *settings
+	return &copied, nil
+}
+
+func (repository *fakeChatRoomRepository) AddRoomMember(ctx context.Context, roomId uuid.UUID, userId int, invitedBy *int, joinMethod RoomJoinMethod) error {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	key := roomMemberKey{RoomId: roomId, UserId: userId}
+	if member, ok := repository.members[key]; ok {
+		if member.JoinMethod == RoomJoinPassword && joinMethod != RoomJoinPassword {
+			member.InvitedBy, member.JoinMethod = invitedBy, joinMethod
+		}
+		return nil
+	}
+	repository.members[key] = &RoomMember{RoomId: roomId, UserId: userId, Role: RoomRoleMember, InvitedBy: invitedBy, JoinMethod: joinMethod, CreatedAt: time.Now()}
+	return nil
+}
+
+func (repository *fakeChatRoomRepository) IsRoomMember(ctx context.Context, roomId uuid.UUID, userId int) (bool, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	_, ok := repository.members[roomMemberKey{RoomId: roomId, UserId: userId}]
+	return ok, nil
+}
+
+func (repository *fakeChatRoomRepository) GetRoomMember(ctx context.Context, roomId uuid.UUID, userId int) (*RoomMember, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	member, ok := repository.members[roomMemberKey{RoomId: roomId, UserId: userId}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *member
+	return &copied, nil
+}
+
+func (repository *fakeChatRoomRepository) GetRoomMembers(ctx context.Context, roomId uuid.UUID) ([]RoomMember, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	var members []RoomMember
+	for key, member := range repository.members {
+		if key.RoomId == roomId {
+			members = append(members, *member)
+		}
+	}
+	return members, nil
+}
+
+func (repository *fakeChatRoomRepository) DeletePasswordRoomMembers(ctx context.Context, roomId uuid.UUID) ([]int, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	var userIds []int
+	for key, member := range repository.members {
+		if key.RoomId == roomId && member.JoinMethod == RoomJoinPassword && member.Role == RoomRoleMember {
+			delete(repository.members, key)
+			userIds = append(userIds, key.UserId)
+		}
+	}
+	return userIds, nil
+}
+
+func (repository *fakeChatRoomRepository) DeleteUninvitedRoomMembers(ctx context.Context, roomId uuid.UUID, ownerId int) ([]int, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	var userIds []int
+	for key, member := range repository.members {
+		if key.RoomId == roomId && member.JoinMethod == RoomJoinDirect && member.InvitedBy == nil && member.Role == RoomRoleMember && key.UserId != ownerId {
+			delete(repository.members, key)
+			userIds = append(userIds, key.UserId)
+		}
+	}
+	return userIds, nil
+}
+
+func (repository *fakeChatRoomRepository) GetRoomInvite(ctx context.Context, code string) (*RoomInvite, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	invite, ok := repository.invites[code]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *invite
+	return &copied, nil
+}
+
+func (repository *fakeChatRoomRepository) UseRoomInvite(ctx context.Context, code string) (*RoomInvite, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	invite, ok := repository.invites[code]
+	if !ok || (invite.ExpiresAt != nil && !invite.ExpiresAt.After(time.Now())) || (invite.MaxUses > 0 && invite.Uses >= invite.MaxUses) {
+		return nil, sql.ErrNoRows
+	}
+	invite.Uses++
+	copied := *invite
+	return &copied, nil
+}
+
+func (repository *fakeChatRoomRepository) UserExists(ctx context.Context, userId int) (bool, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	return repository.userIds[userId], nil
+}
+
+// fakeLobby has nobody connected.
+type fakeLobby struct{}
+
+func (lobby *fakeLobby) SendNotification(message *SocketMessage) {}
+
+func (lobby *fakeLobby) SendMessageToUser(userId int, message *SocketMessage) error {
+	return nil
+}
+
+func (lobby *fakeLobby) IsConnected(userId int) bool {
+	return false
+}
+
+func newTestRoomService(chatRoomRepository IChatRoomRepository) *RoomService {
+	return &RoomService{
+		UserLocation:           make(map[int]uuid.UUID),
+		AllRooms:               make(map[uuid.UUID]*SocketRoom),
+		RoomServiceLock:        new(sync.Mutex),
+		chatRoomRepository:     chatRoomRepository,
+		passwordAttemptLimiter: NewPasswordAttemptLimiter(PasswordAttemptLimits{PerUserAndRoom: MaxRoomPasswordAttempts, PerUser: MaxUserPasswordAttempts, PerRoom: MaxRoomPasswordFailures}, RoomPasswordAttemptWindow),
+		lobby:                  &fakeLobby{},
+	}
+}
+
+// addTestRoom caches a room without loading it from a repository.
+func addTestRoom(t *testing.T, service *RoomService, roomType RoomType, ownerId int) *SocketRoom {
+	t.Helper()
+	room := newRoom(Room{ID: uuid.New(), Name: "test", OwnerId: &ownerId, RoomType: roomType})
+	room.ready.Store(true)
+	t.Cleanup(room.StopMessageListening)
+	service.RoomServiceLock.Lock()
+	service.AllRooms[room.Read().ID] = room
+	service.RoomServiceLock.Unlock()
+	return room
+}
+
+// newTestChatMessageService returns a service with a public room that users 1 to 30 are members of.
+func newTestChatMessageService(t *testing.T) (*ChatMessageService, *fakeChatMessageRepository, *SocketRoom) {
+	t.Helper()
+	roomRepository := newFakeChatRoomRepository()
+	roomService := newTestRoomService(roomRepository)
+	room := addTestRoom(t, roomService, RoomTypePublic, testOwnerId)
+	for userId := 1; userId <= 30; userId++ {
+		if err := roomRepository.AddRoomMember(context.Background(), room.Read().ID, userId, nil, RoomJoinDirect); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messageRepository := newFakeChatMessageRepository()
+	return NewChatMessageService(roomService, messageRepository, nil), messageRepository, room
+}
+
+type reactionKey struct {
+	MessageId string
+	Emoji     string
+	UserId    int
+}
+
+// fakeChatMessageRepository keeps messages and reactions in memory, with the caps the database enforces.
+type fakeChatMessageRepository struct {
+	IChatMessageRepository
+	messages  map[string]*ChatMessage
+	reactions map[reactionKey]bool
+	pins      map[string]*ChatMessagePin
+	lock      *sync.Mutex
+}
+
+func newFakeChatMessageRepository() *fakeChatMessageRepository {
+	return &fakeChatMessageRepository{
+		messages:  make(map[string]*ChatMessage),
+		reactions: make(map[reactionKey]bool),
+		pins:      make(map[string]*ChatMessagePin),
+		lock:      new(sync.Mutex),
+	}
+}
+
+func (repository *fakeChatMessageRepository) addMessage(roomId uuid.UUID, senderId int) *ChatMessage {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	message := &ChatMessage{ID: uuid.NewString(), RoomId: roomId, SenderId: senderId, Content: "hello", IsCommitted: true}
+	repository.messages[message.ID] = message
+	return message
+}
+
+func (repository *fakeChatMessageRepository) GetMessageById(ctx context.Context, messageId string) (*ChatMessage, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	message, ok := repository.messages[messageId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *message
+	return &copied, nil
+}
+
+func (repository *fakeChatMessageRepository) AddReaction(ctx context.Context, messageId string, userId int, emoji string, limits ReactionLimits) (bool, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	key := reactionKey{MessageId: messageId, Emoji: emoji, UserId: userId}
+	if repository.reactions[key] {
+		return false, nil
+	}
+	emojis := make(map[string]bool)
+	userReactions := 0
+	for reaction := range repository.reactions {
+		if reaction.MessageId == messageId {
+			emojis[reaction.Emoji] = true
+			if reaction.UserId == userId {
+				userReactions++
+			}
+		}
+	}
+	if userReactions >= limits.MaxPerUser {
+		return false, ErrUserReactionLimit
+	}
+	if !emojis[emoji] && len(emojis) >= limits.MaxEmojisPerMessage {
+		return false, ErrMessageEmojiLimit
+	}
+	repository.reactions[key] = true
+	return true, nil
+}
+
+func (repository *fakeChatMessageRepository) RemoveReaction(ctx context.Context, messageId string, userId int, emoji string) (bool, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	key := reactionKey{MessageId: messageId, Emoji: emoji, UserId: userId}
+	removed := repository.reactions[key]
+	delete(repository.reactions, key)
+	return removed, nil
+}
+
+func (repository *fakeChatMessageRepository) PinMessage(ctx context.Context, pin *ChatMessagePin, maxPins int) (bool, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	if _, ok := repository.pins[pin.MessageId]; ok {
+		return false, nil
+	}
+	count := 0
+	for _, pinned := range repository.pins {
+		if pinned.RoomId == pin.RoomId {
+			count++
+		}
+	}
+	if count >= maxPins {
+		return false, ErrRoomPinLimit
+	}
+	repository.pins[pin.MessageId] = pin
+	return true, nil
+}
+
+func (repository *fakeChatMessageRepository) GetPinnedMessages(ctx context.Context, roomId uuid.UUID) ([]PinnedMessage, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	var pinnedMessages []PinnedMessage
+	for _, pin := range repository.pins {
+		if pin.RoomId == roomId {
+			pinnedMessages = append(pinnedMessages, PinnedMessage{ChatMessagePin: *pin, Message: repository.messages[pin.MessageId]})
+		}
+	}
+	return pinnedMessages, nil
+}
+
+func (repository *fakeChatMessageRepository) GetThreadMessages(ctx context.Context, parentId string, offset uint, limit uint) ([]*ChatMessage, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	var replies []*ChatMessage
+	for _, message := range repository.messages {
+		if message.ParentId != nil && *message.ParentId == parentId {
+			copied := *message
+			replies = append(replies, &copied)
+		}
+	}
+	return replies, nil
+}
+
+// fakeMentionRepository records the saved mentions.
+type fakeMentionRepository struct {
+	IMentionRepository
+	saved []Mention
+}
+
+func (repository *fakeMentionRepository) GetRoomMemberIdsByName(ctx context.Context, roomId uuid.UUID, userNames []string) ([]int, error) {
+	return nil, nil
+}
+
+func (repository *fakeMentionRepository) SaveMentions(ctx context.Context, mentions []Mention) error {
+	repository.saved = append(repository.saved, mentions...)
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	MaxMentionsPerMessage     = 20 // User names resolved per message, the rest is ignored.
+	DefaultUnreadMentionLimit = 50
+	MaxUnreadMentionLimit     = 200
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]+)`)
+
+type MentionEvent struct {
+	Message     *ChatMessage `json:"message"`
+	MentionType MentionType  `json:"mention_type"`
+}
+
+// parseMentions finds the @user_name mentions of the content and whether it mentions @room or @here.
+func parseMentions(content string) (userNames []string, mentionsRoom bool, mentionsHere bool) {
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		switch {
+		case name == string(MentionTypeRoom):
+			mentionsRoom = true
+		case name == string(MentionTypeHere):
+			mentionsHere = true
+		case len(name) > 0 && !slices.Contains(userNames, name) && len(userNames) < MaxMentionsPerMessage:
+			userNames = append(userNames, name)
+		}
+	}
+	return userNames, mentionsRoom, mentionsHere
+}
+
+// recordMentions stores who the message mentions and notifies them wherever they are. Failures are
+// only logged because the message itself is already sent.
+func (service *ChatMessageService) recordMentions(ctx context.Context, room *SocketRoom, message *ChatMessage) {
+	userNames, mentionsRoom, mentionsHere := parseMentions(message.Content)
+	if mentionsRoom || mentionsHere {
+		// Only moderators may notify the whole room, for everyone else @room and @here are plain text.
+		role, err := service.RoomService.GetRoomRole(ctx, room, message.SenderId)
+		if err != nil {
+			log.Println(fmt.Sprintf("unable to get role of user %v in room %v: %v", message.SenderId, room.Read().ID, err))
+			return
+		}
+		if roomRoleRanks[role] < roomRoleRanks[RoomRoleModerator] {
+			mentionsRoom, mentionsHere = false, false
+		}
+	}
+	if len(userNames) == 0 && !mentionsRoom && !mentionsHere {
+		return
+	}
+
+	mentionTypes := make(map[int]MentionType)
+	if len(userNames) > 0 {
+		userIds, err := service.mentionRepository.GetRoomMemberIdsByName(ctx, room.Read().ID, userNames)
+		if err != nil {
+			log.Println(fmt.Sprintf("unable to resolve mentions of message %v: %v", message.ID, err))
+			return
+		}
+		for _, userId := range userIds {
+			mentionTypes[userId] = MentionTypeUser
+		}
+	}
+	if mentionsRoom || mentionsHere {
+		members, err := service.RoomService.chatRoomRepository.GetRoomMembers(ctx, room.Read().ID)
+		if err != nil {
+			log.Println(fmt.Sprintf("unable to get members of room %v: %v", room.Read().ID, err))
+			return
+		}
+		for _, member := range members {
+			if _, ok := mentionTypes[member.UserId]; ok {
+				continue
+			}
+			if mentionsRoom {
+				mentionTypes[member.UserId] = MentionTypeRoom
+			} else if service.RoomService.lobby.IsConnected(member.UserId) {
+				mentionTypes[member.UserId] = MentionTypeHere
+			}
+		}
+	}
+	delete(mentionTypes, message.SenderId)
+
+	mentions := make([]Mention, 0, len(mentionTypes))
+	for userId, mentionType := range mentionTypes {
+		mentions = append(mentions, Mention{MessageId: message.ID, UserId: userId, RoomId: room.Read().ID, MentionType: mentionType})
+	}
+	if err := service.mentionRepository.SaveMentions(ctx, mentions); err != nil {
+		log.Println(fmt.Sprintf("unable to save mentions of message %v: %v", message.ID, err))
+		return
+	}
+
+	for _, mention := range mentions {
+		if !service.RoomService.lobby.IsConnected(mention.UserId) {
+			continue
+		}
+		body, err := json.Marshal(&MentionEvent{Message: message, MentionType: mention.MentionType})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if err := service.RoomService.lobby.SendMessageToUser(mention.UserId, NewSocketMessage(EventMention, string(body))); err != nil {
+			log.Println(fmt.Sprintf("unable to notify user %v of mention in message %v: %v", mention.UserId, message.ID, err))
+		}
+	}
+}
+
+func (service *ChatMessageService) GetUnreadMentions(ctx context.Context, userId int, limit uint) ([]UnreadMention, error) {
+	if limit == 0 {
+		limit = DefaultUnreadMentionLimit
+	}
+	limit = min(limit, MaxUnreadMentionLimit)
+	return service.mentionRepository.GetUnreadMentions(ctx, userId, limit)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content      string
+		userNames    []string
+		mentionsRoom bool
+		mentionsHere bool
+	}{
+		{"hi @alice and @bob", []string{"alice", "bob"}, false, false},
+		{"@alice, @alice!", []string{"alice"}, false, false},
+		{"thanks @john.doe.", []string{"john.doe"}, false, false},
+		{"mail bob@example.com", nil, false, false},
+		{"@@alice @- @", nil, false, false},
+		{"@room please read", nil, true, false},
+		{"anyone @here?", nil, false, true},
+		{"(@room) @here @carol", []string{"carol"}, true, true},
+	}
+	for _, test := range tests {
+		userNames, mentionsRoom, mentionsHere := parseMentions(test.content)
+		if !slices.Equal(userNames, test.userNames) || mentionsRoom != test.mentionsRoom || mentionsHere != test.mentionsHere {
+			t.Errorf("%q: got %v, %v, %v, want %v, %v, %v", test.content, userNames, mentionsRoom, mentionsHere,
+				test.userNames, test.mentionsRoom, test.mentionsHere)
+		}
+	}
+
+	var content strings.Builder
+	for i := range MaxMentionsPerMessage + 5 {
+		fmt.Fprintf(&content, "@user%d ", i)
+	}
+	if userNames, _, _ := parseMentions(content.String()); len(userNames) != MaxMentionsPerMessage {
+		t.Errorf("got %d user names, want %d", len(userNames), MaxMentionsPerMessage)
+	}
+}
+
+func TestRoomMentionRequiresModerator(t *testing.T) {
+	service, messageRepository, room := newTestChatMessageService(t)
+	mentionRepository := &fakeMentionRepository{}
+	service.mentionRepository = mentionRepository
+	ctx := context.Background()
+
+	message := messageRepository.addMessage(room.Read().ID, 2)
+	message.Content = "@room look at this"
+	service.recordMentions(ctx, room, message)
+	if len(mentionRepository.saved) != 0 {
+		t.Errorf("member notified the room: %d mentions", len(mentionRepository.saved))
+	}
+
+	message = messageRepository.addMessage(room.Read().ID, testOwnerId)
+	message.Content = "@room look at this"
+	service.recordMentions(ctx, room, message)
+	// Every member but the sender.
+	if len(mentionRepository.saved) != 29 {
+		t.Errorf("owner notified %d members, want 29", len(mentionRepository.saved))
+	}
+	for _, mention := range mentionRepository.saved {
+		if mention.MentionType != MentionTypeRoom || mention.UserId == testOwnerId {
+			t.Errorf("unexpected mention %+v", mention)
+		}
+	}
+}
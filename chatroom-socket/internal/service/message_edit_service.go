@@ -0,0 +1,137 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+type EditMessageSchema struct {
+	MessageId string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+type DeleteMessageSchema struct {
+	MessageId string `json:"message_id"`
+}
+
+type MessageDeletedEvent struct {
+	MessageId string `json:"message_id"`
+	RoomId    string `json:"room_id"`
+	DeletedBy int    `json:"deleted_by"`
+}
+
+// getRoomMessage loads a message of a listed room. Direct messages are not handled here.
+func (service *ChatMessageService) getRoomMessage(ctx context.Context, messageId string) (*ChatMessage, *SocketRoom, error) {
+	if _, err := uuid.Parse(messageId); err != nil {
+		return nil, nil, fmt.Errorf("%w: message_id %q is not a valid id", ErrInvalidMessage, messageId)
+	}
+	message, err := service.chatMessageRepository.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMessageNotFound, messageId)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	room, err := service.RoomService.GetRoom(message.RoomId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, room, nil
+}
+
+// EditMessage lets the sender change their message. The previous content goes to the edit history.
+func (service *ChatMessageService) EditMessage(ctx context.Context, user User, messageId string, content string) (*ChatMessage, error) {
+	if len(content) == 0 {
+		return nil, errors.New("message content is required")
+	}
+	message, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderId != user.ID {
+		return nil, fmt.Errorf("%w: %v", ErrNotMessageSender, messageId)
+	}
+	if message.IsDeleted {
+		return nil, fmt.Errorf("%w: %v", ErrMessageDeleted, messageId)
+	}
+	if mutedUntil, isMuted := room.Moderation.MutedUntil(user.ID); isMuted {
+		return nil, fmt.Errorf("%w until %v", ErrUserMuted, mutedUntil.Format(time.RFC3339))
+	}
+
+	editedMessage, err := service.chatMessageRepository.EditMessage(ctx, messageId, content, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(editedMessage)
+	if err != nil {
+		return nil, err
+	}
+	room.broadcastMessage(NewSocketMessage(EventMessageEdited, string(body)))
+	return editedMessage, nil
+}
+
+// DeleteMessage replaces the message with a tombstone. Senders delete their own messages and
+// moderators any message of their room.
+func (service *ChatMessageService) DeleteMessage(ctx context.Context, user User, messageId string) error {
+	message, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return err
+	}
+	if message.IsDeleted {
+		return fmt.Errorf("%w: %v", ErrMessageDeleted, messageId)
+	}
+	if message.SenderId != user.ID {
+		role, err := service.RoomService.GetRoomRole(ctx, room, user.ID)
+		if err != nil {
+			return err
+		}
+		if roomRoleRanks[role] < roomRoleRanks[RoomRoleModerator] {
+			return fmt.Errorf("%w: deleting messages of others requires role %v", ErrInsufficientRoomRole, RoomRoleModerator)
+		}
+	}
+
+	if err := service.chatMessageRepository.DeleteMessage(ctx, messageId, user.ID); err != nil {
+		return err
+	}
+	log.Println(fmt.Sprintf("user %v deleted message %v of room %v", user.ID, messageId, room.Read().ID))
+	body, err := json.Marshal(&MessageDeletedEvent{MessageId: messageId, RoomId: room.Read().ID.String(), DeletedBy: user.ID})
+	if err != nil {
+		return err
+	}
+	room.broadcastMessage(NewSocketMessage(EventMessageDeleted, string(body)))
+	return nil
+}
+
+// GetMessageEdits returns the edit history of a message to the members of its room.
+func (service *ChatMessageService) GetMessageEdits(ctx context.Context, user User, messageId string) ([]ChatMessageEdit, error) {
+	_, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := service.RoomService.chatRoomRepository.IsRoomMember(ctx, room.Read().ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: %v", ErrNotRoomMember, room.Read().ID)
+	}
+	return service.chatMessageRepository.GetMessageEdits(ctx, messageId)
+}
+
+func (service *ChatMessageService) handleEventEditMessage(ctx context.Context, user User, schema *EditMessageSchema) error {
+	if _, err := service.EditMessage(ctx, user, schema.MessageId, schema.Content); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (service *ChatMessageService) handleEventDeleteMessage(ctx context.Context, user User, schema *DeleteMessageSchema) error {
+	return service.DeleteMessage(ctx, user, schema.MessageId)
+}
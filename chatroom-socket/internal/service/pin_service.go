@@ -0,0 +1,105 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+)
+
+const MaxPinnedMessagesPerRoom = 50
+
+type PinSchema struct {
+	MessageId string `json:"message_id"`
+}
+
+type PinEvent struct {
+	MessageId string       `json:"message_id"`
+	RoomId    string       `json:"room_id"`
+	UserId    int          `json:"user_id"`
+	Message   *ChatMessage `json:"message,omitempty"` // Only sent with message_pinned.
+}
+
+// authorizePin loads a message of a room where the user may pin, which requires the moderator role.
+func (service *ChatMessageService) authorizePin(ctx context.Context, user User, messageId string) (*ChatMessage, *SocketRoom, error) {
+	message, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return nil, nil, err
+	}
+	role, err := service.RoomService.GetRoomRole(ctx, room, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if roomRoleRanks[role] < roomRoleRanks[RoomRoleModerator] {
+		return nil, nil, fmt.Errorf("%w: pinning messages requires role %v", ErrInsufficientRoomRole, RoomRoleModerator)
+	}
+	return message, room, nil
+}
+
+func (service *ChatMessageService) PinMessage(ctx context.Context, user User, messageId string) error {
+	message, room, err := service.authorizePin(ctx, user, messageId)
+	if err != nil {
+		return err
+	}
+	if message.IsDeleted {
+		return fmt.Errorf("%w: %v", ErrMessageDeleted, messageId)
+	}
+	pin := &ChatMessagePin{MessageId: message.ID, RoomId: room.Read().ID, PinnedBy: user.ID}
+	pinned, err := service.chatMessageRepository.PinMessage(ctx, pin, MaxPinnedMessagesPerRoom)
+	switch {
+	case errors.Is(err, ErrRoomPinLimit):
+		return fmt.Errorf("%w: at most %d pinned messages per room", ErrPinLimitReached, MaxPinnedMessagesPerRoom)
+	case err != nil || !pinned:
+		return err
+	}
+	log.Println(fmt.Sprintf("user %v pinned message %v of room %v", user.ID, messageId, room.Read().ID))
+	return service.broadcastPin(room, EventMessagePinned, &PinEvent{MessageId: message.ID, RoomId: room.Read().ID.String(), UserId: user.ID, Message: message})
+}
+
+func (service *ChatMessageService) UnpinMessage(ctx context.Context, user User, messageId string) error {
+	message, room, err := service.authorizePin(ctx, user, messageId)
+	if err != nil {
+		return err
+	}
+	unpinned, err := service.chatMessageRepository.UnpinMessage(ctx, message.ID)
+	if err != nil || !unpinned {
+		return err
+	}
+	log.Println(fmt.Sprintf("user %v unpinned message %v of room %v", user.ID, messageId, room.Read().ID))
+	return service.broadcastPin(room, EventMessageUnpinned, &PinEvent{MessageId: message.ID, RoomId: room.Read().ID.String(), UserId: user.ID})
+}
+
+// GetPinnedMessages returns the pinned messages of the room to its members.
+func (service *ChatMessageService) GetPinnedMessages(ctx context.Context, user User, roomId uuid.UUID) ([]PinnedMessage, error) {
+	if _, err := service.RoomService.GetRoom(roomId); err != nil {
+		return nil, err
+	}
+	isMember, err := service.RoomService.chatRoomRepository.IsRoomMember(ctx, roomId, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: %v", ErrNotRoomMember, roomId)
+	}
+	return service.chatMessageRepository.GetPinnedMessages(ctx, roomId)
+}
+
+func (service *ChatMessageService) broadcastPin(room *SocketRoom, event EventType, pin *PinEvent) error {
+	body, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+	room.broadcastMessage(NewSocketMessage(event, string(body)))
+	return nil
+}
+
+func (service *ChatMessageService) handleEventPinMessage(ctx context.Context, user User, schema *PinSchema) error {
+	return service.PinMessage(ctx, user, schema.MessageId)
+}
+
+func (service *ChatMessageService) handleEventUnpinMessage(ctx context.Context, user User, schema *PinSchema) error {
+	return service.UnpinMessage(ctx, user, schema.MessageId)
+}
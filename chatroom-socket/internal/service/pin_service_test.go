@@ -0,0 +1,69 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPinMessageConcurrentCap(t *testing.T) {
+	service, repository, room := newTestChatMessageService(t)
+	owner := User{ID: testOwnerId}
+	ctx := context.Background()
+
+	var pinned, limited atomic.Int32
+	var wg sync.WaitGroup
+	for range MaxPinnedMessagesPerRoom + 10 {
+		message := repository.addMessage(room.Read().ID, 2)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := service.PinMessage(ctx, owner, message.ID)
+			switch {
+			case err == nil:
+				pinned.Add(1)
+			case errors.Is(err, ErrPinLimitReached):
+				limited.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if pinned.Load() != MaxPinnedMessagesPerRoom || limited.Load() != 10 {
+		t.Errorf("got %d pinned and %d limited, want %d and 10", pinned.Load(), limited.Load(), MaxPinnedMessagesPerRoom)
+	}
+}
+
+func TestPinMessageRequiresModerator(t *testing.T) {
+	service, repository, room := newTestChatMessageService(t)
+	message := repository.addMessage(room.Read().ID, 2)
+
+	if err := service.PinMessage(context.Background(), User{ID: 2}, message.ID); !errors.Is(err, ErrInsufficientRoomRole) {
+		t.Errorf("member pinning: got %v, want %v", err, ErrInsufficientRoomRole)
+	}
+	repository.messages[message.ID].IsDeleted = true
+	if err := service.PinMessage(context.Background(), User{ID: testOwnerId}, message.ID); !errors.Is(err, ErrMessageDeleted) {
+		t.Errorf("deleted message: got %v, want %v", err, ErrMessageDeleted)
+	}
+}
+
+func TestGetPinnedMessagesRequiresMembership(t *testing.T) {
+	service, repository, room := newTestChatMessageService(t)
+	message := repository.addMessage(room.Read().ID, 2)
+	ctx := context.Background()
+	if err := service.PinMessage(ctx, User{ID: testOwnerId}, message.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.GetPinnedMessages(ctx, User{ID: 99}, room.Read().ID); !errors.Is(err, ErrNotRoomMember) {
+		t.Errorf("stranger: got %v, want %v", err, ErrNotRoomMember)
+	}
+	pinnedMessages, err := service.GetPinnedMessages(ctx, User{ID: 2}, room.Read().ID)
+	if err != nil || len(pinnedMessages) != 1 {
+		t.Errorf("member: got %d pinned messages, %v", len(pinnedMessages), err)
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAwayAfter    = 5 * time.Minute
+	MaxStatusTextLength = 140
+)
+
+type userActivity struct {
+	LastActivity time.Time
+	Presence     Presence // PresenceOnline or PresenceAway, users without activity are offline.
+}
+
+// PresenceService tracks whether connected users are online or away and remembers when
+// they were last seen. Changes are broadcast to the room the user is in.
+type PresenceService struct {
+	SocketService      *SocketService
+	RoomService        *RoomService
+	AwayAfter          time.Duration
+	presenceRepository IUserPresenceRepository
+	activities         map[int]*userActivity
+	presenceLock       *sync.Mutex
+}
+
+func NewPresenceService(socketService *SocketService, roomService *RoomService, presenceRepository IUserPresenceRepository, awayAfter time.Duration) *PresenceService {
+	return &PresenceService{
+		SocketService:      socketService,
+		RoomService:        roomService,
+		AwayAfter:          awayAfter,
+		presenceRepository: presenceRepository,
+		activities:         make(map[int]*userActivity),
+		presenceLock:       new(sync.Mutex),
+	}
+}
+
+func (service *PresenceService) UserConnected(ctx context.Context, user User) {
+	service.presenceLock.Lock()
+	activity, ok := service.activities[user.ID]
+	if ok && activity.Presence == PresenceOnline {
+		activity.LastActivity = time.Now()
+		service.presenceLock.Unlock()
+		return
+	}
+	service.activities[user.ID] = &userActivity{LastActivity: time.Now(), Presence: PresenceOnline}
+	service.presenceLock.Unlock()
+	service.broadcastPresence(ctx, user.ID)
+}
+
+// UserDisconnected marks the user offline and saves their last seen time once their last device is gone.
+func (service *PresenceService) UserDisconnected(ctx context.Context, user User) {
+	if service.SocketService.IsConnected(user.ID) {
+		return
+	}
+	service.presenceLock.Lock()
+	delete(service.activities, user.ID)
+	service.presenceLock.Unlock()
+
+	if err := service.presenceRepository.SaveLastSeen(ctx, user.ID, time.Now().UTC()); err != nil {
+		log.Println(fmt.Sprintf("unable to save last seen of user %v: %v", user.ID, err))
+	}
+	service.broadcastPresence(ctx, user.ID)
+}
+
+// RecordActivity brings an away user back online. It is called for every request the user sends.
+func (service *PresenceService) RecordActivity(ctx context.Context, user User) {
+	service.presenceLock.Lock()
+	activity, ok := service.activities[user.ID]
+	if !ok {
+		service.presenceLock.Unlock()
+		return
+	}
+	activity.LastActivity = time.Now()
+	wasAway := activity.Presence == PresenceAway
+	activity.Presence = PresenceOnline
+	service.presenceLock.Unlock()
+	if wasAway {
+		service.broadcastPresence(ctx, user.ID)
+	}
+}
+
+func (service *PresenceService) MarkIdleUsersAway(ctx context.Context) {
+	var idleUserIds []int
+	service.presenceLock.Lock()
+	for userId, activity := range service.activities {
+		if activity.Presence == PresenceOnline && time.Since(activity.LastActivity) > service.AwayAfter {
+			activity.Presence = PresenceAway
+			idleUserIds = append(idleUserIds, userId)
+		}
+	}
+	service.presenceLock.Unlock()
+	for _, userId := range idleUserIds {
+		service.broadcastPresence(ctx, userId)
+	}
+}
+
+func (service *PresenceService) WatchIdleUsers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.MarkIdleUsersAway(ctx)
+		}
+	}
+}
+
+func (service *PresenceService) SetStatusText(ctx context.Context, user User, statusText string) error {
+	if len([]rune(statusText)) > MaxStatusTextLength {
+		return fmt.Errorf("status_text can't be longer than %d characters", MaxStatusTextLength)
+	}
+	if err := service.presenceRepository.SaveStatusText(ctx, user.ID, statusText); err != nil {
+		return err
+	}
+	service.broadcastPresence(ctx, user.ID)
+	return nil
+}
+
+func (service *PresenceService) getPresence(userId int) Presence {
+	service.presenceLock.Lock()
+	defer service.presenceLock.Unlock()
+	if activity, ok := service.activities[userId]; ok {
+		return activity.Presence
+	}
+	return PresenceOffline
+}
+
+func (service *PresenceService) GetUserPresences(ctx context.Context, userIds []int) ([]UserPresenceView, error) {
+	records, err := service.presenceRepository.GetUserPresences(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+	recordsByUserId := make(map[int]UserPresence, len(records))
+	for _, record := range records {
+		recordsByUserId[record.UserId] = record
+	}
+
+	views := make([]UserPresenceView, 0, len(userIds))
+	for _, userId := range userIds {
+		record, ok := recordsByUserId[userId]
+		if !ok {
+			record = UserPresence{UserId: userId}
+		}
+		views = append(views, UserPresenceView{UserPresence: record, Presence: service.getPresence(userId)})
+	}
+	return views, nil
+}
+
+// broadcastPresence sends the current presence of the user to the room they are in, if any.
+func (service *PresenceService) broadcastPresence(ctx context.Context, userId int) {
+	room, err := service.RoomService.getUserRoom(userId)
+	if err != nil {
+		return
+	}
+	views, err := service.GetUserPresences(ctx, []int{userId})
+	if err != nil {
+		log.Println(fmt.Sprintf("unable to get presence of user %v: %v", userId, err))
+		return
+	}
+	body, err := json.Marshal(views[0])
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	room.broadcastMessage(NewSocketMessage(EventPresenceChanged, string(body)))
+}
+
+type SetStatusSchema struct {
+	StatusText string `json:"status_text"`
+}
+
+func (service *PresenceService) RegisterSocketEvents(registry *SocketEventRegistry) error {
+	setStatus := NewSocketEventHandler(EventSetStatus, service.handleEventSetStatus)
+	setStatus.RateLimit = RateLimit{Count: 5, Window: time.Minute}
+	return registry.Register(setStatus)
+}
+
+func (service *PresenceService) handleEventSetStatus(ctx context.Context, user User, schema *SetStatusSchema) error {
+	return service.SetStatusText(ctx, user, schema.StatusText)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+type rateLimitKey struct {
+	UserId int
+	Action string
+}
+
+type rateLimitWindow struct {
+	Count       int
+	WindowStart time.Time
+}
+
+// RateLimiter counts the actions of every user in fixed windows.
+type RateLimiter struct {
+	windows map[rateLimitKey]*rateLimitWindow
+	lock    *sync.Mutex
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		windows: make(map[rateLimitKey]*rateLimitWindow),
+		lock:    new(sync.Mutex),
+	}
+}
+
+// Allow counts one action of the user and reports whether it stays within the limit.
+func (limiter *RateLimiter) Allow(userId int, action string, limit RateLimit) bool {
+	if limit.Count <= 0 {
+		return true
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	key := rateLimitKey{UserId: userId, Action: action}
+	window, ok := limiter.windows[key]
+	if !ok || time.Since(window.WindowStart) > limit.Window {
+		limiter.windows[key] = &rateLimitWindow{Count: 1, WindowStart: time.Now()}
+		return true
+	}
+	if window.Count >= limit.Count {
+		return false
+	}
+	window.Count++
+	return true
+}
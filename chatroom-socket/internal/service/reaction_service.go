@@ -0,0 +1,126 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxReactionEmojisPerMessage = 20 // Distinct emojis on one message.
+	MaxReactionsPerUser         = 5  // Emojis one user can put on one message.
+	MaxReactionEmojiLength      = 32
+)
+
+// ReactionRateLimit is shared by adding and removing reactions, over REST and socket alike.
+var ReactionRateLimit = RateLimit{Count: 20, Window: 10 * time.Second}
+
+type ReactionSchema struct {
+	MessageId string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type ReactionEvent struct {
+	MessageId string `json:"message_id"`
+	RoomId    string `json:"room_id"`
+	UserId    int    `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+func validateReactionEmoji(emoji string) error {
+	if len(emoji) == 0 {
+		return fmt.Errorf("%w: emoji is required", ErrInvalidMessage)
+	}
+	if utf8.RuneCountInString(emoji) > MaxReactionEmojiLength || strings.ContainsAny(emoji, " \t\n") {
+		return fmt.Errorf("%w: emoji %q is not valid", ErrInvalidMessage, emoji)
+	}
+	return nil
+}
+
+// getReactableMessage loads a message that the user may react to.
+func (service *ChatMessageService) getReactableMessage(ctx context.Context, user User, messageId string) (*ChatMessage, *SocketRoom, error) {
+	message, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message.IsDeleted {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMessageDeleted, messageId)
+	}
+	isMember, err := service.RoomService.chatRoomRepository.IsRoomMember(ctx, room.Read().ID, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isMember {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNotRoomMember, room.Read().ID)
+	}
+	return message, room, nil
+}
+
+func (service *ChatMessageService) allowReaction(userId int) error {
+	if !service.reactionRateLimiter.Allow(userId, "reaction", ReactionRateLimit) {
+		return fmt.Errorf("%w: at most %d reactions per %v", ErrRateLimited, ReactionRateLimit.Count, ReactionRateLimit.Window)
+	}
+	return nil
+}
+
+func (service *ChatMessageService) AddReaction(ctx context.Context, user User, messageId string, emoji string) error {
+	if err := validateReactionEmoji(emoji); err != nil {
+		return err
+	}
+	if err := service.allowReaction(user.ID); err != nil {
+		return err
+	}
+	message, room, err := service.getReactableMessage(ctx, user, messageId)
+	if err != nil {
+		return err
+	}
+
+	limits := ReactionLimits{MaxEmojisPerMessage: MaxReactionEmojisPerMessage, MaxPerUser: MaxReactionsPerUser}
+	added, err := service.chatMessageRepository.AddReaction(ctx, message.ID, user.ID, emoji, limits)
+	switch {
+	case errors.Is(err, ErrUserReactionLimit):
+		return fmt.Errorf("%w: at most %d reactions per user", ErrReactionLimitReached, MaxReactionsPerUser)
+	case errors.Is(err, ErrMessageEmojiLimit):
+		return fmt.Errorf("%w: at most %d different emojis per message", ErrReactionLimitReached, MaxReactionEmojisPerMessage)
+	case err != nil || !added:
+		return err
+	}
+	return service.broadcastReaction(room, EventReactionAdded, &ReactionEvent{MessageId: message.ID, RoomId: room.Read().ID.String(), UserId: user.ID, Emoji: emoji})
+}
+
+func (service *ChatMessageService) RemoveReaction(ctx context.Context, user User, messageId string, emoji string) error {
+	if err := service.allowReaction(user.ID); err != nil {
+		return err
+	}
+	message, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return err
+	}
+	removed, err := service.chatMessageRepository.RemoveReaction(ctx, message.ID, user.ID, emoji)
+	if err != nil || !removed {
+		return err
+	}
+	return service.broadcastReaction(room, EventReactionRemoved, &ReactionEvent{MessageId: message.ID, RoomId: room.Read().ID.String(), UserId: user.ID, Emoji: emoji})
+}
+
+func (service *ChatMessageService) broadcastReaction(room *SocketRoom, event EventType, reaction *ReactionEvent) error {
+	body, err := json.Marshal(reaction)
+	if err != nil {
+		return err
+	}
+	room.broadcastMessage(NewSocketMessage(event, string(body)))
+	return nil
+}
+
+func (service *ChatMessageService) handleEventAddReaction(ctx context.Context, user User, schema *ReactionSchema) error {
+	return service.AddReaction(ctx, user, schema.MessageId, schema.Emoji)
+}
+
+func (service *ChatMessageService) handleEventRemoveReaction(ctx context.Context, user User, schema *ReactionSchema) error {
+	return service.RemoveReaction(ctx, user, schema.MessageId, schema.Emoji)
+}
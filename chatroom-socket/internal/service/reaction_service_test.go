@@ -0,0 +1,50 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAddReactionCaps(t *testing.T) {
+	service, repository, room := newTestChatMessageService(t)
+	message := repository.addMessage(room.Read().ID, testOwnerId)
+	ctx := context.Background()
+
+	// Every user stays within their own cap while the message fills up.
+	for i := range MaxReactionEmojisPerMessage {
+		if err := service.AddReaction(ctx, User{ID: 2 + i/MaxReactionsPerUser}, message.ID, fmt.Sprintf("emoji%d", i)); err != nil {
+			t.Fatalf("emoji %d: %v", i, err)
+		}
+	}
+	if err := service.AddReaction(ctx, User{ID: 2}, message.ID, "emoji_last"); !errors.Is(err, ErrReactionLimitReached) {
+		t.Errorf("over the user cap: got %v, want %v", err, ErrReactionLimitReached)
+	}
+	if err := service.AddReaction(ctx, User{ID: 20}, message.ID, "new_emoji"); !errors.Is(err, ErrReactionLimitReached) {
+		t.Errorf("over the emoji cap: got %v, want %v", err, ErrReactionLimitReached)
+	}
+	// Joining an emoji that is already on the message doesn't add to the cap.
+	if err := service.AddReaction(ctx, User{ID: 20}, message.ID, "emoji0"); err != nil {
+		t.Errorf("existing emoji rejected at the cap: %v", err)
+	}
+}
+
+func TestAddReactionRejected(t *testing.T) {
+	service, repository, room := newTestChatMessageService(t)
+	message := repository.addMessage(room.Read().ID, testOwnerId)
+	ctx := context.Background()
+
+	if err := service.AddReaction(ctx, User{ID: 31}, message.ID, "emoji"); !errors.Is(err, ErrNotRoomMember) {
+		t.Errorf("stranger: got %v, want %v", err, ErrNotRoomMember)
+	}
+	for i := range ReactionRateLimit.Count {
+		if err := service.RemoveReaction(ctx, User{ID: 2}, message.ID, "emoji"); err != nil {
+			t.Fatalf("reaction %d: %v", i, err)
+		}
+	}
+	if err := service.AddReaction(ctx, User{ID: 2}, message.ID, "emoji"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("over the rate limit: got %v, want %v", err, ErrRateLimited)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// notifyMessageCommitted tells every device of the sender that the message is persisted.
+func (service *ChatMessageService) notifyMessageCommitted(message *ChatMessage) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := service.RoomService.lobby.SendMessageToUser(message.SenderId, NewSocketMessage(EventMessageCommitted, string(body))); err != nil {
+		log.Println(fmt.Sprintf("unable to notify user %v of committed message %v: %v", message.SenderId, message.ID, err))
+	}
+}
+
+// MarkRead moves the read marker of the user up to the message and broadcasts a read receipt
+// to the room when the marker moved.
+func (service *ChatMessageService) MarkRead(ctx context.Context, user User, messageId string) (*ReadMarker, error) {
+	message, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := service.RoomService.chatRoomRepository.IsRoomMember(ctx, room.Read().ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: %v", ErrNotRoomMember, room.Read().ID)
+	}
+
+	marker, err := service.chatMessageRepository.SaveReadMarker(ctx, &ReadMarker{
+		RoomId:            room.Read().ID,
+		UserId:            user.ID,
+		LastReadMessageId: &message.ID,
+		LastReadAt:        message.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := service.mentionRepository.MarkMentionsRead(ctx, user.ID, room.Read().ID, marker.LastReadAt); err != nil {
+		log.Println(fmt.Sprintf("unable to mark mentions of user %v in room %v as read: %v", user.ID, room.Read().ID, err))
+	}
+	if !marker.LastReadAt.Equal(message.CreatedAt) {
+		return marker, nil
+	}
+
+	body, err := json.Marshal(marker)
+	if err != nil {
+		return nil, err
+	}
+	room.broadcastMessage(NewSocketMessage(EventReadReceipt, string(body)))
+	return marker, nil
+}
+
+func (service *ChatMessageService) GetUnreadCounts(ctx context.Context, userId int) ([]UnreadCount, error) {
+	return service.chatMessageRepository.GetUnreadCounts(ctx, userId)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// GetArchivedRooms lists every archived room for admins and only their own rooms for everyone else.
+func (service *RoomService) GetArchivedRooms(ctx context.Context, actor User) ([]ArchivedRoom, error) {
+	if actor.IsAdmin() {
+		return service.chatRoomRepository.GetArchivedRooms(ctx, nil)
+	}
+	return service.chatRoomRepository.GetArchivedRooms(ctx, &actor.ID)
+}
+
+func (service *RoomService) RestoreRoom(ctx context.Context, actor User, roomId uuid.UUID) (*SocketRoom, error) {
+	archivedRoom, err := service.chatRoomRepository.GetArchivedRoomById(ctx, roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no archived room %v", ErrRoomNotFound, roomId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !archivedRoom.IsOwnedBy(actor.ID) && !actor.IsAdmin() {
+		return nil, fmt.Errorf("%w: user %v, room %v", ErrNotRoomOwner, actor.ID, roomId)
+	}
+
+	if err := service.chatRoomRepository.RestoreRoom(ctx, roomId); err != nil {
+		return nil, err
+	}
+	read, err := service.chatRoomRepository.GetRoomById(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	log.Println(fmt.Sprintf("user %v restored room %v", actor.UserName, roomId))
+	return service.addRoomToCache(*read), nil
+}
+
+func (service *RoomService) PurgeArchivedRooms(ctx context.Context, retention time.Duration) error {
+	roomIds, err := service.chatRoomRepository.PurgeArchivedRooms(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	for _, roomId := range roomIds {
+		log.Println(fmt.Sprintf("Purged archived room: %v", roomId))
+	}
+	return nil
+}
+
+func (service *RoomService) WatchArchivedRooms(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.PurgeArchivedRooms(ctx, retention); err != nil {
+				log.Println(fmt.Sprintf("unable to purge archived rooms: %v", err))
+			}
+		}
+	}
+}
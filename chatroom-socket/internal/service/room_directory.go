@@ -0,0 +1,155 @@
+package service
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"time"
+)
+
+const MaxRoomViewLimit = 200
+
+// roomViewCursor is the sort key of the last room of a page. Rooms after it form the next page.
+type roomViewCursor struct {
+	Id             uuid.UUID `json:"id"`
+	NumberOfPeople uint      `json:"number_of_people"`
+	RoomName       string    `json:"room_name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func encodeRoomViewCursor(view RoomView) (string, error) {
+	body, err := json.Marshal(roomViewCursor{
+		Id:             view.Id,
+		NumberOfPeople: view.NumberOfPeople,
+		RoomName:       view.RoomName,
+		CreatedAt:      view.CreatedAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(body), nil
+}
+
+func decodeRoomViewCursor(cursor string) (*RoomView, error) {
+	body, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("cursor is not valid")
+	}
+	var decoded roomViewCursor
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, errors.New("cursor is not valid")
+	}
+	return &RoomView{
+		Id:             decoded.Id,
+		NumberOfPeople: decoded.NumberOfPeople,
+		RoomName:       decoded.RoomName,
+		CreatedAt:      decoded.CreatedAt,
+	}, nil
+}
+
+// compareRoomViews orders by the sort field and breaks ties by id so that cursors are stable.
+func compareRoomViews(sortBy RoomSortField, descending bool, a RoomView, b RoomView) int {
+	var result int
+	switch sortBy {
+	case RoomSortByNumberOfPeople:
+		result = cmp.Compare(a.NumberOfPeople, b.NumberOfPeople)
+	case RoomSortByCreatedAt:
+		result = a.CreatedAt.Compare(b.CreatedAt)
+	default:
+		result = cmp.Compare(strings.ToLower(a.RoomName), strings.ToLower(b.RoomName))
+	}
+	if descending {
+		result = -result
+	}
+	if result != 0 {
+		return result
+	}
+	return strings.Compare(a.Id.String(), b.Id.String())
+}
+
+func (query *RoomViewQuery) validate() error {
+	validSortFields := []RoomSortField{RoomSortByNumberOfPeople, RoomSortByName, RoomSortByCreatedAt}
+	if len(query.SortBy) == 0 {
+		query.SortBy = RoomSortByName
+	}
+	if !slices.Contains(validSortFields, query.SortBy) {
+		return errors.New(fmt.Sprintf("sort_by must be one of %v", validSortFields))
+	}
+	if query.Limit < 0 || query.Limit > MaxRoomViewLimit {
+		return errors.New(fmt.Sprintf("limit must be between 0 and %v", MaxRoomViewLimit))
+	}
+	return nil
+}
+
+func (query *RoomViewQuery) matches(view RoomView) bool {
+	if len(query.RoomType) != 0 && view.RoomType != query.RoomType {
+		return false
+	}
+	if query.OwnerId != 0 && (view.OwnerId == nil || *view.OwnerId != query.OwnerId) {
+		return false
+	}
+	if len(query.Name) != 0 && !strings.Contains(strings.ToLower(view.RoomName), strings.ToLower(query.Name)) {
+		return false
+	}
+	return true
+}
+
+func (service *RoomService) GetAllRoomViews(query *RoomViewQuery) (*RoomViewPage, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	service.RoomServiceLock.Lock()
+	roomViews := make([]RoomView, 0, len(service.AllRooms))
+	for _, room := range service.AllRooms {
+		view := RoomView{
+			Id:             room.Read().ID,
+			NumberOfPeople: room.NumberOfPeople,
+			RoomName:       room.Read().Name,
+			RoomType:       room.Read().RoomType,
+			OwnerId:        room.Read().OwnerId,
+			CreatedAt:      room.Read().CreatedAt,
+		}
+		if query.matches(view) {
+			roomViews = append(roomViews, view)
+		}
+	}
+	service.RoomServiceLock.Unlock()
+
+	compare := func(a RoomView, b RoomView) int {
+		return compareRoomViews(query.SortBy, query.Descending, a, b)
+	}
+	slices.SortFunc(roomViews, compare)
+	page := &RoomViewPage{Total: len(roomViews)}
+
+	start := 0
+	if len(query.Cursor) != 0 {
+		cursorView, err := decodeRoomViewCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		start = len(roomViews)
+		for index, view := range roomViews {
+			if compare(view, *cursorView) > 0 {
+				start = index
+				break
+			}
+		}
+	}
+	end := len(roomViews)
+	if query.Limit > 0 && start+query.Limit < end {
+		end = start + query.Limit
+		cursor, err := encodeRoomViewCursor(roomViews[end-1])
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+	page.Rooms = roomViews[start:end]
+	return page, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// isIdleEphemeralRoom reads the people of the room, so the caller holds the service lock.
+func isIdleEphemeralRoom(room *SocketRoom) bool {
+	if room.Read().IdleTtlSeconds == nil || room.NumberOfPeople != 0 || room.EmptySince.IsZero() {
+		return false
+	}
+	idleTtl := time.Duration(*room.Read().IdleTtlSeconds) * time.Second
+	return time.Since(room.EmptySince) > idleTtl
+}
+
+// CloseIdleEphemeralRooms archives the ephemeral rooms that have been empty for longer than their idle TTL.
+func (service *RoomService) CloseIdleEphemeralRooms(ctx context.Context) {
+	var idleRooms []*SocketRoom
+	service.RoomServiceLock.Lock()
+	for _, room := range service.AllRooms {
+		if isIdleEphemeralRoom(room) {
+			idleRooms = append(idleRooms, room)
+		}
+	}
+	service.RoomServiceLock.Unlock()
+
+	for _, room := range idleRooms {
+		if !service.claimIdleEphemeralRoom(room) {
+			continue
+		}
+		log.Println(fmt.Sprintf("Closing idle ephemeral room: %v", room.Read().ID))
+		if err := service.chatRoomRepository.DeleteRoom(ctx, room.Read().ID); err != nil {
+			log.Println(fmt.Sprintf("unable to close ephemeral room %v: %v", room.Read().ID, err))
+			service.returnRoomToCache(room)
+			continue
+		}
+		if err := service.shutdownRoom(room); err != nil {
+			log.Println(fmt.Sprintf("unable to close ephemeral room %v: %v", room.Read().ID, err))
+		}
+	}
+}
+
+// claimIdleEphemeralRoom takes the room out of the cache if it is still idle, so that nobody can join it
+// while it is archived.
+func (service *RoomService) claimIdleEphemeralRoom(room *SocketRoom) bool {
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
+	if !isIdleEphemeralRoom(room) {
+		return false
+	}
+	return service.unsafeRemoveRoomFromCache(room)
+}
+
+// returnRoomToCache undoes claimIdleEphemeralRoom. If the room was cached again in between,
+// the claimed room is stopped in favor of the new one.
+func (service *RoomService) returnRoomToCache(room *SocketRoom) {
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
+	if _, exists := service.AllRooms[room.Read().ID]; exists {
+		room.StopMessageListening()
+		return
+	}
+	service.AllRooms[room.Read().ID] = room
+}
+
+func (service *RoomService) WatchEphemeralRooms(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.CloseIdleEphemeralRooms(ctx)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+const inviteCodeBytes = 12
+
+// JoinRoomCredentials proves access to a private room, either the room password or an invite code.
+type JoinRoomCredentials struct {
+	Password   string `json:"room_password"`
+	InviteCode string `json:"invite_code"`
+}
+
+type CreateRoomInviteSchema struct {
+	ExpiresInSeconds int `json:"expires_in_seconds"` // 0 means the invite never expires.
+	MaxUses          int `json:"max_uses"`           // 0 means the invite can be used any number of times.
+}
+
+// newRandomToken returns size random bytes encoded for use in URLs.
+func newRandomToken(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+func (service *RoomService) getOwnedRoom(roomId uuid.UUID, userId int) (*SocketRoom, error) {
+	room, err := service.GetRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	if !room.Read().IsOwnedBy(userId) {
+		return nil, fmt.Errorf("%w: user %v, room %v", ErrNotRoomOwner, userId, roomId)
+	}
+	return room, nil
+}
+
+// authorizeRoomJoin lets anyone into public rooms and the owner or existing members into private ones.
+// Everyone else needs an invite code or the room password. A successful join is persisted as membership,
+// password memberships only last until the password changes.
+func (service *RoomService) authorizeRoomJoin(ctx context.Context, room *SocketRoom, user User, credentials JoinRoomCredentials) error {
+	roomId := room.Read().ID
+	if room.Moderation.IsBanned(user.ID) {
+		return fmt.Errorf("%w: %v", ErrUserBanned, roomId)
+	}
+	if room.Read().RoomType != RoomTypePrivate || room.Read().IsOwnedBy(user.ID) {
+		return service.chatRoomRepository.AddRoomMember(ctx, roomId, user.ID, nil, RoomJoinDirect)
+	}
+
+	isMember, err := service.chatRoomRepository.IsRoomMember(ctx, roomId, user.ID)
+	if err != nil {
+		return err
+	}
+	if isMember {
+		return nil
+	}
+
+	if len(credentials.InviteCode) != 0 {
+		invite, err := service.useRoomInvite(ctx, roomId, credentials.InviteCode)
+		if err != nil {
+			return err
+		}
+		return service.chatRoomRepository.AddRoomMember(ctx, roomId, user.ID, &invite.CreatedBy, RoomJoinInvite)
+	}
+
+	if err := service.verifyRoomPassword(ctx, room, user, credentials.Password); err != nil {
+		return err
+	}
+	return service.chatRoomRepository.AddRoomMember(ctx, roomId, user.ID, nil, RoomJoinPassword)
+}
+
+func (service *RoomService) useRoomInvite(ctx context.Context, roomId uuid.UUID, code string) (*RoomInvite, error) {
+	invite, err := service.GetRoomInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if invite.RoomId != roomId {
+		return nil, fmt.Errorf("%w: not an invite for room %v", ErrInviteNotFound, roomId)
+	}
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		return nil, ErrInviteExpired
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return nil, ErrInviteExhausted
+	}
+
+	// Another user may have taken the last use in between.
+	invite, err = service.chatRoomRepository.UseRoomInvite(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInviteExhausted
+	}
+	return invite, err
+}
+
+func (service *RoomService) GetRoomInvite(ctx context.Context, code string) (*RoomInvite, error) {
+	invite, err := service.chatRoomRepository.GetRoomInvite(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (service *RoomService) CreateRoomInvite(ctx context.Context, userId int, roomId uuid.UUID, schema *CreateRoomInviteSchema) (*RoomInvite, error) {
+	if _, err := service.getOwnedRoom(roomId, userId); err != nil {
+		return nil, err
+	}
+	if schema.ExpiresInSeconds < 0 {
+		return nil, errors.New("expires_in_seconds can't be negative")
+	}
+	if schema.MaxUses < 0 {
+		return nil, errors.New("max_uses can't be negative")
+	}
+
+	code, err := newRandomToken(inviteCodeBytes)
+	if err != nil {
+		return nil, err
+	}
+	invite := &RoomInvite{
+		Code:      code,
+		RoomId:    roomId,
+		CreatedBy: userId,
+		MaxUses:   schema.MaxUses,
+	}
+	if schema.ExpiresInSeconds > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(schema.ExpiresInSeconds) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+	log.Println(fmt.Sprintf("user %v created invite for room %v", userId, roomId))
+	return service.chatRoomRepository.CreateRoomInvite(ctx, invite)
+}
+
+func (service *RoomService) InviteUser(ctx context.Context, userId int, roomId uuid.UUID, inviteeId int) (*SocketRoom, error) {
+	room, err := service.getOwnedRoom(roomId, userId)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := service.chatRoomRepository.UserExists(ctx, inviteeId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %v", ErrUserNotFound, inviteeId)
+	}
+	if err := service.chatRoomRepository.AddRoomMember(ctx, roomId, inviteeId, &userId, RoomJoinDirect); err != nil {
+		return nil, err
+	}
+	log.Println(fmt.Sprintf("user %v invited user %v to room %v", userId, inviteeId, roomId))
+	return room, nil
+}
+
+// revokePasswordMembers drops the memberships granted by a previous room password. Users
+// still in the room stay until they leave, rejoining needs the new password.
+func (service *RoomService) revokePasswordMembers(ctx context.Context, roomId uuid.UUID) error {
+	userIds, err := service.chatRoomRepository.DeletePasswordRoomMembers(ctx, roomId)
+	if err != nil {
+		return err
+	}
+	if len(userIds) != 0 {
+		log.Println(fmt.Sprintf("revoked password membership of users %v in room %v", userIds, roomId))
+	}
+	return nil
+}
+
+// revokeUninvitedMembers is called when a public room turns private, so that the users who
+// only visited it while it was public need an invite or the password to get back in.
+func (service *RoomService) revokeUninvitedMembers(ctx context.Context, room *Room) error {
+	ownerId := 0
+	if room.OwnerId != nil {
+		ownerId = *room.OwnerId
+	}
+	userIds, err := service.chatRoomRepository.DeleteUninvitedRoomMembers(ctx, room.ID, ownerId)
+	if err != nil {
+		return err
+	}
+	if len(userIds) != 0 {
+		log.Println(fmt.Sprintf("revoked membership of uninvited users %v in room %v", userIds, room.ID))
+	}
+	return nil
+}
+
+func (service *RoomService) GetRoomMembers(ctx context.Context, userId int, roomId uuid.UUID) ([]RoomMember, error) {
+	room, err := service.GetRoom(roomId)
+	if err != nil {
+		return nil, err
+	}
+	if room.Read().RoomType == RoomTypePrivate && !room.Read().IsOwnedBy(userId) {
+		isMember, err := service.chatRoomRepository.IsRoomMember(ctx, roomId, userId)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, ErrNotRoomMember
+		}
+	}
+	return service.chatRoomRepository.GetRoomMembers(ctx, roomId)
+}
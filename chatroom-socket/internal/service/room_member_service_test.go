@@ -0,0 +1,202 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testOwnerId = 1
+
+func newTestInvite(repository *fakeChatRoomRepository, room *SocketRoom, code string, maxUses int) *RoomInvite {
+	invite := &RoomInvite{Code: code, RoomId: room.Read().ID, CreatedBy: testOwnerId, MaxUses: maxUses}
+	repository.invites[code] = invite
+	return invite
+}
+
+func TestAuthorizeRoomJoinConsumesInvite(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	room := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+	invite := newTestInvite(repository, room, "code", 2)
+	ctx := context.Background()
+
+	user := User{ID: 2, UserName: "guest"}
+	if err := service.authorizeRoomJoin(ctx, room, user, JoinRoomCredentials{InviteCode: "code"}); err != nil {
+		t.Fatalf("join with invite: %v", err)
+	}
+	if invite.Uses != 1 {
+		t.Errorf("invite uses: got %d, want 1", invite.Uses)
+	}
+	member, err := repository.GetRoomMember(ctx, room.Read().ID, user.ID)
+	if err != nil {
+		t.Fatalf("membership not recorded: %v", err)
+	}
+	if member.JoinMethod != RoomJoinInvite || member.InvitedBy == nil || *member.InvitedBy != testOwnerId {
+		t.Errorf("membership: got join method %v invited by %v", member.JoinMethod, member.InvitedBy)
+	}
+
+	// Members get back in without spending another use.
+	if err := service.authorizeRoomJoin(ctx, room, user, JoinRoomCredentials{InviteCode: "code"}); err != nil {
+		t.Fatalf("rejoin: %v", err)
+	}
+	if invite.Uses != 1 {
+		t.Errorf("rejoin used the invite again: %d uses", invite.Uses)
+	}
+}
+
+func TestAuthorizeRoomJoinRejectsInvite(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	room := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+	otherRoom := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+
+	newTestInvite(repository, otherRoom, "other-room", 0)
+	expiresAt := time.Now().Add(-time.Minute)
+	newTestInvite(repository, room, "expired", 0).ExpiresAt = &expiresAt
+	newTestInvite(repository, room, "exhausted", 1).Uses = 1
+
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"unknown", ErrInviteNotFound},
+		{"other-room", ErrInviteNotFound},
+		{"expired", ErrInviteExpired},
+		{"exhausted", ErrInviteExhausted},
+	}
+	for _, test := range tests {
+		err := service.authorizeRoomJoin(context.Background(), room, User{ID: 2}, JoinRoomCredentials{InviteCode: test.code})
+		if !errors.Is(err, test.want) {
+			t.Errorf("invite %q: got %v, want %v", test.code, err, test.want)
+		}
+	}
+	if isMember, _ := repository.IsRoomMember(context.Background(), room.Read().ID, 2); isMember {
+		t.Error("rejected invite granted membership")
+	}
+}
+
+func TestAuthorizeRoomJoinLastInviteUse(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	room := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+	invite := newTestInvite(repository, room, "code", 1)
+
+	var joined, exhausted atomic.Int32
+	var wg sync.WaitGroup
+	for userId := 2; userId < 12; userId++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := service.authorizeRoomJoin(context.Background(), room, User{ID: userId}, JoinRoomCredentials{InviteCode: "code"})
+			switch {
+			case err == nil:
+				joined.Add(1)
+			case errors.Is(err, ErrInviteExhausted):
+				exhausted.Add(1)
+			default:
+				t.Errorf("user %d: %v", userId, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if joined.Load() != 1 || exhausted.Load() != 9 || invite.Uses != 1 {
+		t.Errorf("got %d joined and %d exhausted with %d uses, want 1, 9 and 1", joined.Load(), exhausted.Load(), invite.Uses)
+	}
+}
+
+func TestRevokePasswordMembers(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	room := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+	ctx := context.Background()
+	password, err := HashRoomPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.settings[room.Read().ID] = &ChatRoomSettings{RoomType: RoomTypePrivate, Password: &password}
+	newTestInvite(repository, room, "code", 0)
+
+	if err := service.authorizeRoomJoin(ctx, room, User{ID: 2}, JoinRoomCredentials{Password: "secret"}); err != nil {
+		t.Fatalf("join with password: %v", err)
+	}
+	if err := service.authorizeRoomJoin(ctx, room, User{ID: 3}, JoinRoomCredentials{InviteCode: "code"}); err != nil {
+		t.Fatalf("join with invite: %v", err)
+	}
+	if err := service.revokePasswordMembers(ctx, room.Read().ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if isMember, _ := repository.IsRoomMember(ctx, room.Read().ID, 2); isMember {
+		t.Error("password membership survived the revocation")
+	}
+	if isMember, _ := repository.IsRoomMember(ctx, room.Read().ID, 3); !isMember {
+		t.Error("invite membership was revoked")
+	}
+	err = service.authorizeRoomJoin(ctx, room, User{ID: 2}, JoinRoomCredentials{})
+	if !errors.Is(err, ErrRoomPasswordRequired) {
+		t.Errorf("rejoin after revocation: got %v, want %v", err, ErrRoomPasswordRequired)
+	}
+}
+
+func TestInviteUnknownUser(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	room := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+	repository.userIds[2] = true
+
+	if _, err := service.InviteUser(context.Background(), testOwnerId, room.Read().ID, 3); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown invitee: got %v, want %v", err, ErrUserNotFound)
+	}
+	if _, err := service.InviteUser(context.Background(), testOwnerId, room.Read().ID, 2); err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	member, err := repository.GetRoomMember(context.Background(), room.Read().ID, 2)
+	if err != nil || member.JoinMethod != RoomJoinDirect {
+		t.Errorf("invited member: got %+v, %v", member, err)
+	}
+}
+
+func TestEditRoomToPrivateRevokesVisitors(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	room := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	roomId := room.Read().ID
+	repository.rooms[roomId] = room.Read()
+	repository.settings[roomId] = &ChatRoomSettings{ID: uuid.New(), RoomType: RoomTypePublic}
+	ctx := context.Background()
+
+	const visitorId, invitedId, moderatorId = 2, 3, 4
+	for _, userId := range []int{testOwnerId, visitorId, moderatorId} {
+		if err := service.authorizeRoomJoin(ctx, room, User{ID: userId}, JoinRoomCredentials{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repository.members[roomMemberKey{RoomId: roomId, UserId: moderatorId}].Role = RoomRoleModerator
+	repository.userIds[invitedId] = true
+	if _, err := service.InviteUser(ctx, testOwnerId, roomId, invitedId); err != nil {
+		t.Fatal(err)
+	}
+
+	roomType, password := RoomTypePrivate, "secret"
+	if _, _, err := service.EditRoom(ctx, testOwnerId, roomId, &UpdateRoomSchema{RoomType: &roomType, RoomPassword: &password}); err != nil {
+		t.Fatalf("edit room: %v", err)
+	}
+	if room.Read().RoomType != RoomTypePrivate {
+		t.Fatalf("room type: got %v, want %v", room.Read().RoomType, RoomTypePrivate)
+	}
+	for userId, want := range map[int]bool{testOwnerId: true, visitorId: false, invitedId: true, moderatorId: true} {
+		if isMember, _ := repository.IsRoomMember(ctx, roomId, userId); isMember != want {
+			t.Errorf("user %d: got member %v, want %v", userId, isMember, want)
+		}
+	}
+	err := service.authorizeRoomJoin(ctx, room, User{ID: visitorId}, JoinRoomCredentials{})
+	if !errors.Is(err, ErrRoomPasswordRequired) {
+		t.Errorf("visitor rejoin: got %v, want %v", err, ErrRoomPasswordRequired)
+	}
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"sync"
+	"time"
+)
+
+type ModerationAction string
+
+const (
+	ModerationKick    ModerationAction = "kick"
+	ModerationMute    ModerationAction = "mute"
+	ModerationUnmute  ModerationAction = "unmute"
+	ModerationBan     ModerationAction = "ban"
+	ModerationUnban   ModerationAction = "unban"
+	ModerationSetRole ModerationAction = "set_role"
+)
+
+var roomRoleRanks = map[RoomRole]int{
+	RoomRoleMember:    1,
+	RoomRoleModerator: 2,
+	RoomRoleOwner:     3,
+}
+
+type ModerationSchema struct {
+	UserId          int      `json:"user_id"`
+	DurationSeconds int      `json:"duration_seconds"` // Required for mute, optional for ban where 0 means permanent.
+	Reason          string   `json:"reason"`
+	Role            RoomRole `json:"role"` // Only used by set_role.
+}
+
+// ModerationEvent is broadcast to the room as EventRoomModeration content.
+type ModerationEvent struct {
+	Action    ModerationAction `json:"action"`
+	RoomId    uuid.UUID        `json:"room_id"`
+	UserId    int              `json:"user_id"`
+	ActorId   int              `json:"actor_id"`
+	Reason    string           `json:"reason,omitempty"`
+	Role      RoomRole         `json:"role,omitempty"`
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"`
+}
+
+// RoomModeration caches the active bans and mutes of a room so that joins and messages
+// can be checked without a database round trip. A zero time means the sanction is permanent.
+type RoomModeration struct {
+	bannedUntil map[int]time.Time
+	mutedUntil  map[int]time.Time
+	lock        *sync.RWMutex
+}
+
+func newRoomModeration() *RoomModeration {
+	return &RoomModeration{
+		bannedUntil: make(map[int]time.Time),
+		mutedUntil:  make(map[int]time.Time),
+		lock:        new(sync.RWMutex),
+	}
+}
+
+func isSanctionActive(until time.Time) bool {
+	return until.IsZero() || time.Now().Before(until)
+}
+
+func (moderation *RoomModeration) Ban(userId int, expiresAt *time.Time) {
+	moderation.lock.Lock()
+	defer moderation.lock.Unlock()
+	var until time.Time
+	if expiresAt != nil {
+		until = *expiresAt
+	}
+	moderation.bannedUntil[userId] = until
+}
+
+func (moderation *RoomModeration) Unban(userId int) {
+	moderation.lock.Lock()
+	defer moderation.lock.Unlock()
+	delete(moderation.bannedUntil, userId)
+}
+
+func (moderation *RoomModeration) IsBanned(userId int) bool {
+	moderation.lock.RLock()
+	defer moderation.lock.RUnlock()
+	until, ok := moderation.bannedUntil[userId]
+	return ok && isSanctionActive(until)
+}
+
+func (moderation *RoomModeration) Mute(userId int, until time.Time) {
+	moderation.lock.Lock()
+	defer moderation.lock.Unlock()
+	moderation.mutedUntil[userId] = until
+}
+
+func (moderation *RoomModeration) Unmute(userId int) {
+	moderation.lock.Lock()
+	defer moderation.lock.Unlock()
+	delete(moderation.mutedUntil, userId)
+}
+
+func (moderation *RoomModeration) MutedUntil(userId int) (time.Time, bool) {
+	moderation.lock.RLock()
+	defer moderation.lock.RUnlock()
+	until, ok := moderation.mutedUntil[userId]
+	return until, ok && isSanctionActive(until)
+}
+
+// PruneExpired forgets the bans and mutes that ran out.
+func (moderation *RoomModeration) PruneExpired() {
+	moderation.lock.Lock()
+	defer moderation.lock.Unlock()
+	for userId, until := range moderation.bannedUntil {
+		if !isSanctionActive(until) {
+			delete(moderation.bannedUntil, userId)
+		}
+	}
+	for userId, until := range moderation.mutedUntil {
+		if !isSanctionActive(until) {
+			delete(moderation.mutedUntil, userId)
+		}
+	}
+}
+
+func (service *RoomService) PruneExpiredSanctions() {
+	service.RoomServiceLock.Lock()
+	rooms := make([]*SocketRoom, 0, len(service.AllRooms))
+	for _, room := range service.AllRooms {
+		rooms = append(rooms, room)
+	}
+	service.RoomServiceLock.Unlock()
+	for _, room := range rooms {
+		room.Moderation.PruneExpired()
+	}
+}
+
+func (service *RoomService) WatchExpiredSanctions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.PruneExpiredSanctions()
+		}
+	}
+}
+
+func (service *RoomService) loadRoomModeration(ctx context.Context, room *SocketRoom) error {
+	sanctions, err := service.chatRoomRepository.GetActiveRoomSanctions(ctx, room.Read().ID)
+	if err != nil {
+		return err
+	}
+	for _, sanction := range sanctions {
+		switch sanction.SanctionType {
+		case SanctionTypeBan:
+			room.Moderation.Ban(sanction.UserId, sanction.ExpiresAt)
+		case SanctionTypeMute:
+			if sanction.ExpiresAt != nil {
+				room.Moderation.Mute(sanction.UserId, *sanction.ExpiresAt)
+			}
+		}
+	}
+	return nil
+}
+
+func (service *RoomService) GetRoomRole(ctx context.Context, room *SocketRoom, userId int) (RoomRole, error) {
+	if room.Read().IsOwnedBy(userId) {
+		return RoomRoleOwner, nil
+	}
+	member, err := service.chatRoomRepository.GetRoomMember(ctx, room.Read().ID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func (service *RoomService) authorizeModeration(ctx context.Context, room *SocketRoom, actorId int, targetId int, action ModerationAction) error {
+	actorRole, err := service.GetRoomRole(ctx, room, actorId)
+	if err != nil {
+		return err
+	}
+	targetRole, err := service.GetRoomRole(ctx, room, targetId)
+	if err != nil {
+		return err
+	}
+
+	requiredRole := RoomRoleModerator
+	if action == ModerationSetRole {
+		requiredRole = RoomRoleOwner
+	}
+	if roomRoleRanks[actorRole] < roomRoleRanks[requiredRole] {
+		return fmt.Errorf("%w: %v requires role %v", ErrInsufficientRoomRole, action, requiredRole)
+	}
+	if action == ModerationSetRole && len(targetRole) == 0 {
+		return fmt.Errorf("%w: user %v", ErrNotRoomMember, targetId)
+	}
+	if roomRoleRanks[targetRole] >= roomRoleRanks[actorRole] {
+		return fmt.Errorf("%w: can't %v a user with role %v", ErrInsufficientRoomRole, action, targetRole)
+	}
+	return nil
+}
+
+func (service *RoomService) ModerateUser(ctx context.Context, actor User, roomId uuid.UUID, action ModerationAction, schema *ModerationSchema) error {
+	room, err := service.GetRoom(roomId)
+	if err != nil {
+		return err
+	}
+	if schema.UserId == 0 {
+		return errors.New("user_id is required")
+	}
+	if schema.UserId == actor.ID {
+		return errors.New("user can't moderate themselves")
+	}
+	if err := service.authorizeModeration(ctx, room, actor.ID, schema.UserId, action); err != nil {
+		return err
+	}
+
+	event := &ModerationEvent{
+		Action:  action,
+		RoomId:  roomId,
+		UserId:  schema.UserId,
+		ActorId: actor.ID,
+		Reason:  schema.Reason,
+	}
+	sanction := &RoomSanction{
+		RoomId:   roomId,
+		UserId:   schema.UserId,
+		IssuedBy: actor.ID,
+		Reason:   schema.Reason,
+	}
+	if schema.DurationSeconds > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(schema.DurationSeconds) * time.Second)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	switch action {
+	case ModerationKick:
+	case ModerationMute:
+		if sanction.ExpiresAt == nil {
+			return errors.New("duration_seconds is required for mute")
+		}
+		sanction.SanctionType = SanctionTypeMute
+		if err := service.chatRoomRepository.SaveRoomSanction(ctx, sanction); err != nil {
+			return err
+		}
+		room.Moderation.Mute(schema.UserId, *sanction.ExpiresAt)
+		event.ExpiresAt = sanction.ExpiresAt
+	case ModerationUnmute:
+		if err := service.chatRoomRepository.DeleteRoomSanction(ctx, roomId, schema.UserId, SanctionTypeMute); err != nil {
+			return err
+		}
+		room.Moderation.Unmute(schema.UserId)
+	case ModerationBan:
+		sanction.SanctionType = SanctionTypeBan
+		if err := service.chatRoomRepository.SaveRoomSanction(ctx, sanction); err != nil {
+			return err
+		}
+		room.Moderation.Ban(schema.UserId, sanction.ExpiresAt)
+		event.ExpiresAt = sanction.ExpiresAt
+	case ModerationUnban:
+		if err := service.chatRoomRepository.DeleteRoomSanction(ctx, roomId, schema.UserId, SanctionTypeBan); err != nil {
+			return err
+		}
+		room.Moderation.Unban(schema.UserId)
+	case ModerationSetRole:
+		if schema.Role != RoomRoleModerator && schema.Role != RoomRoleMember {
+			return errors.New("role must be moderator or member")
+		}
+		if err := service.chatRoomRepository.SetRoomMemberRole(ctx, roomId, schema.UserId, schema.Role); err != nil {
+			return err
+		}
+		event.Role = schema.Role
+	default:
+		return errors.New(fmt.Sprintf("moderation action %v is not valid", action))
+	}
+	log.Println(fmt.Sprintf("user %v applied %v to user %v in room %v", actor.UserName, action, schema.UserId, roomId))
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// Broadcast before removing the user so that they learn why they left.
+	room.broadcastMessage(NewSocketMessage(EventRoomModeration, string(body)))
+
+	if action == ModerationKick || action == ModerationBan {
+		return service.removeUserFromRoom(ctx, room, schema.UserId)
+	}
+	return nil
+}
+
+// removeUserFromRoom revokes the membership of the user and drops them from the room if they are in it.
+func (service *RoomService) removeUserFromRoom(ctx context.Context, room *SocketRoom, userId int) error {
+	if err := service.chatRoomRepository.DeleteRoomMember(ctx, room.Read().ID, userId); err != nil {
+		return err
+	}
+
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
+	if roomId, ok := service.UserLocation[userId]; !ok || roomId != room.Read().ID {
+		return nil
+	}
+	socketUser, err := room.GetSocketUser(userId)
+	if err != nil {
+		return err
+	}
+	_, err = service.UnsafeUserLeaveRoom(socketUser.User)
+	return err
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// OwnershipChangedEvent is broadcast to the room as EventRoomOwnershipChanged content.
+type OwnershipChangedEvent struct {
+	RoomId          uuid.UUID `json:"room_id"`
+	PreviousOwnerId *int      `json:"previous_owner_id"` // Nil when the previous owner account was deleted.
+	OwnerId         int       `json:"owner_id"`
+	ActorId         int       `json:"actor_id"` // 0 when the orphaned room policy reassigned the room.
+}
+
+// TransferOwnership lets the owner hand the room to one of its members. Admins can hand it to anyone.
+func (service *RoomService) TransferOwnership(ctx context.Context, actor User, roomId uuid.UUID, newOwnerId int) error {
+	room, err := service.GetRoom(roomId)
+	if err != nil {
+		return err
+	}
+	isOwner := room.Read().IsOwnedBy(actor.ID)
+	if !isOwner && !actor.IsAdmin() {
+		return fmt.Errorf("%w: user %v, room %v", ErrNotRoomOwner, actor.ID, roomId)
+	}
+	if newOwnerId == 0 {
+		return errors.New("user_id is required")
+	}
+	if room.Read().IsOwnedBy(newOwnerId) {
+		return errors.New(fmt.Sprintf("user %v already owns room %v", newOwnerId, roomId))
+	}
+	if !actor.IsAdmin() {
+		isMember, err := service.chatRoomRepository.IsRoomMember(ctx, roomId, newOwnerId)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return fmt.Errorf("%w: user %v", ErrNotRoomMember, newOwnerId)
+		}
+	}
+	return service.changeRoomOwner(ctx, room, newOwnerId, actor.ID)
+}
+
+func (service *RoomService) changeRoomOwner(ctx context.Context, room *SocketRoom, newOwnerId int, actorId int) error {
+	roomId := room.Read().ID
+	previousOwnerId := room.Read().OwnerId
+	if err := service.chatRoomRepository.TransferRoomOwnership(ctx, roomId, previousOwnerId, newOwnerId); err != nil {
+		return err
+	}
+	if err := service.UpdateRoom(ctx, roomId); err != nil {
+		return err
+	}
+	if previousOwnerId != nil {
+		log.Println(fmt.Sprintf("room %v ownership changed from user %v to user %v", roomId, *previousOwnerId, newOwnerId))
+	} else {
+		log.Println(fmt.Sprintf("ownerless room %v was handed to user %v", roomId, newOwnerId))
+	}
+
+	body, err := json.Marshal(&OwnershipChangedEvent{
+		RoomId:          roomId,
+		PreviousOwnerId: previousOwnerId,
+		OwnerId:         newOwnerId,
+		ActorId:         actorId,
+	})
+	if err != nil {
+		return err
+	}
+	room.broadcastMessage(NewSocketMessage(EventRoomOwnershipChanged, string(body)))
+	return nil
+}
+
+// ReassignOrphanedRooms hands every room whose owner account is gone to its oldest moderator.
+// Rooms without a moderator are flagged for admins instead.
+func (service *RoomService) ReassignOrphanedRooms(ctx context.Context) error {
+	roomIds, err := service.chatRoomRepository.GetOwnerlessRoomIds(ctx)
+	if err != nil {
+		return err
+	}
+	for _, roomId := range roomIds {
+		room, err := service.GetRoom(roomId)
+		if err != nil {
+			log.Println(fmt.Sprintf("orphaned room %v is not cached yet: %v", roomId, err))
+			continue
+		}
+		moderator, err := service.chatRoomRepository.GetOldestRoomModerator(ctx, roomId)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Println(fmt.Sprintf("room %v has no owner nor moderator, flagging it for admins", roomId))
+			if err := service.chatRoomRepository.FlagOrphanedRoom(ctx, roomId); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := service.changeRoomOwner(ctx, room, moderator.UserId, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (service *RoomService) WatchOrphanedRooms(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.ReassignOrphanedRooms(ctx); err != nil {
+				log.Println(fmt.Sprintf("unable to reassign orphaned rooms: %v", err))
+			}
+		}
+	}
+}
+
+func (service *RoomService) GetOrphanedRooms(ctx context.Context, actor User) ([]OrphanedRoom, error) {
+	if !actor.IsAdmin() {
+		return nil, ErrAdminRequired
+	}
+	return service.chatRoomRepository.GetOrphanedRooms(ctx)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
+)
+
+const (
+	MaxRoomPasswordAttempts   = 5  // Failures of one user on one room.
+	MaxUserPasswordAttempts   = 20 // Failures of one user over all rooms.
+	MaxRoomPasswordFailures   = 50 // Failures of all users on one room.
+	RoomPasswordAttemptWindow = 5 * time.Minute
+	RoomPasswordThrottleDelay = 2 * time.Second // Added to every attempt on a room past MaxRoomPasswordFailures.
+)
+
+func HashRoomPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// IsRoomPasswordHash tells bcrypt hashes apart from the plaintext passwords that the admin service stores.
+func IsRoomPasswordHash(storedPassword string) bool {
+	_, err := bcrypt.Cost([]byte(storedPassword))
+	return err == nil
+}
+
+// CompareRoomPassword checks the password against the stored bcrypt hash. A plaintext stored password
+// is compared in constant time instead.
+func CompareRoomPassword(storedPassword string, password string) error {
+	if !IsRoomPasswordHash(storedPassword) {
+		storedDigest := sha256.Sum256([]byte(storedPassword))
+		digest := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(storedDigest[:], digest[:]) != 1 {
+			return ErrWrongRoomPassword
+		}
+		return nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrWrongRoomPassword
+	}
+	return err
+}
+
+type passwordAttemptKey struct {
+	UserId int
+	RoomId uuid.UUID
+}
+
+type passwordAttempt struct {
+	Failures    int
+	WindowStart time.Time
+}
+
+// PasswordAttemptLimits caps the failed attempts within the window. A user is blocked on a room once
+// their own counters reach the limit. A room past its limit only slows down every attempt, so that
+// failures of other users can't lock out the ones who know the password.
+type PasswordAttemptLimits struct {
+	PerUserAndRoom int
+	PerUser        int
+	PerRoom        int
+}
+
+// PasswordAttemptLimiter counts failed password attempts per user and room, per user and per room.
+// The per room counter slows down guessing spread over many accounts.
+type PasswordAttemptLimiter struct {
+	Limits              PasswordAttemptLimits
+	Window              time.Duration
+	RoomDelay           time.Duration
+	userAndRoomAttempts map[passwordAttemptKey]*passwordAttempt
+	userAttempts        map[int]*passwordAttempt
+	roomAttempts        map[uuid.UUID]*passwordAttempt
+	lock                *sync.Mutex
+}
+
+func NewPasswordAttemptLimiter(limits PasswordAttemptLimits, window time.Duration) *PasswordAttemptLimiter {
+	return &PasswordAttemptLimiter{
+		Limits:              limits,
+		Window:              window,
+		RoomDelay:           RoomPasswordThrottleDelay,
+		userAndRoomAttempts: make(map[passwordAttemptKey]*passwordAttempt),
+		userAttempts:        make(map[int]*passwordAttempt),
+		roomAttempts:        make(map[uuid.UUID]*passwordAttempt),
+		lock:                new(sync.Mutex),
+	}
+}
+
+func isAttemptBlocked[K comparable](attempts map[K]*passwordAttempt, key K, maxAttempts int, window time.Duration) bool {
+	attempt, ok := attempts[key]
+	if !ok {
+		return false
+	}
+	if time.Since(attempt.WindowStart) > window {
+		delete(attempts, key)
+		return false
+	}
+	return attempt.Failures >= maxAttempts
+}
+
+func recordAttemptFailure[K comparable](attempts map[K]*passwordAttempt, key K, window time.Duration) {
+	attempt, ok := attempts[key]
+	if !ok || time.Since(attempt.WindowStart) > window {
+		attempts[key] = &passwordAttempt{Failures: 1, WindowStart: time.Now()}
+		return
+	}
+	attempt.Failures++
+}
+
+func (limiter *PasswordAttemptLimiter) IsBlocked(userId int, roomId uuid.UUID) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	key := passwordAttemptKey{UserId: userId, RoomId: roomId}
+	blockedOnRoom := isAttemptBlocked(limiter.userAndRoomAttempts, key, limiter.Limits.PerUserAndRoom, limiter.Window)
+	blockedUser := isAttemptBlocked(limiter.userAttempts, userId, limiter.Limits.PerUser, limiter.Window)
+	return blockedOnRoom || blockedUser
+}
+
+// Delay returns how long to wait before checking a password of the room, zero unless the room
+// reached its limit.
+func (limiter *PasswordAttemptLimiter) Delay(roomId uuid.UUID) time.Duration {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if isAttemptBlocked(limiter.roomAttempts, roomId, limiter.Limits.PerRoom, limiter.Window) {
+		return limiter.RoomDelay
+	}
+	return 0
+}
+
+func (limiter *PasswordAttemptLimiter) RecordFailure(userId int, roomId uuid.UUID) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	recordAttemptFailure(limiter.userAndRoomAttempts, passwordAttemptKey{UserId: userId, RoomId: roomId}, limiter.Window)
+	recordAttemptFailure(limiter.userAttempts, userId, limiter.Window)
+	recordAttemptFailure(limiter.roomAttempts, roomId, limiter.Window)
+}
+
+// Reset forgets the failures on the room after a correct password. The per user counter keeps running,
+// so that one known password doesn't open the door to guessing others.
+func (limiter *PasswordAttemptLimiter) Reset(userId int, roomId uuid.UUID) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	delete(limiter.userAndRoomAttempts, passwordAttemptKey{UserId: userId, RoomId: roomId})
+	delete(limiter.roomAttempts, roomId)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompareRoomPassword(t *testing.T) {
+	hashed, err := HashRoomPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsRoomPasswordHash(hashed) || IsRoomPasswordHash("secret") {
+		t.Fatalf("hash detection: %q", hashed)
+	}
+	// The admin service may still store plaintext passwords.
+	for _, storedPassword := range []string{hashed, "secret"} {
+		if err := CompareRoomPassword(storedPassword, "secret"); err != nil {
+			t.Errorf("correct password rejected: %v", err)
+		}
+		for _, password := range []string{"", "secret ", "Secret"} {
+			if err := CompareRoomPassword(storedPassword, password); !errors.Is(err, ErrWrongRoomPassword) {
+				t.Errorf("password %q: got %v, want %v", password, err, ErrWrongRoomPassword)
+			}
+		}
+	}
+}
+
+func newTestPasswordAttemptLimiter(window time.Duration) *PasswordAttemptLimiter {
+	return NewPasswordAttemptLimiter(PasswordAttemptLimits{PerUserAndRoom: 2, PerUser: 3, PerRoom: 4}, window)
+}
+
+func TestPasswordAttemptLimiterPerUser(t *testing.T) {
+	limiter := newTestPasswordAttemptLimiter(time.Minute)
+	roomId := uuid.New()
+	limiter.RecordFailure(1, roomId)
+	limiter.RecordFailure(1, roomId)
+	if !limiter.IsBlocked(1, roomId) || limiter.IsBlocked(1, uuid.New()) || limiter.IsBlocked(2, roomId) {
+		t.Fatal("the per user and room limit should only block user 1 on the room")
+	}
+	limiter.Reset(1, roomId)
+	if limiter.IsBlocked(1, roomId) {
+		t.Error("still blocked after a correct password")
+	}
+
+	// A correct password on one room doesn't clear the failures on the others.
+	limiter.RecordFailure(1, uuid.New())
+	if !limiter.IsBlocked(1, uuid.New()) {
+		t.Error("user guessing over many rooms is not blocked")
+	}
+}
+
+func TestPasswordAttemptLimiterPerRoom(t *testing.T) {
+	limiter := newTestPasswordAttemptLimiter(time.Minute)
+	roomId := uuid.New()
+	for userId := 1; userId <= 4; userId++ {
+		limiter.RecordFailure(userId, roomId)
+	}
+	if limiter.IsBlocked(5, roomId) {
+		t.Error("failures of other users locked out the room")
+	}
+	if limiter.Delay(roomId) != RoomPasswordThrottleDelay || limiter.Delay(uuid.New()) != 0 {
+		t.Error("only the room guessed by many users should be slowed down")
+	}
+	limiter.Reset(5, roomId)
+	if limiter.Delay(roomId) != 0 {
+		t.Error("correct password didn't lift the room throttle")
+	}
+}
+
+func TestVerifyRoomPasswordThrottledRoom(t *testing.T) {
+	repository := newFakeChatRoomRepository()
+	service := newTestRoomService(repository)
+	service.passwordAttemptLimiter.RoomDelay = 10 * time.Millisecond
+	room := addTestRoom(t, service, RoomTypePrivate, testOwnerId)
+	password, err := HashRoomPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.settings[room.Read().ID] = &ChatRoomSettings{RoomType: RoomTypePrivate, Password: &password}
+	for userId := 100; userId < 100+MaxRoomPasswordFailures; userId++ {
+		service.passwordAttemptLimiter.RecordFailure(userId, room.Read().ID)
+	}
+
+	ctx := context.Background()
+	if err := service.verifyRoomPassword(ctx, room, User{ID: 2}, "wrong"); !errors.Is(err, ErrWrongRoomPassword) {
+		t.Errorf("wrong password: got %v, want %v", err, ErrWrongRoomPassword)
+	}
+	if err := service.verifyRoomPassword(ctx, room, User{ID: 3}, "secret"); err != nil {
+		t.Errorf("correct password locked out: %v", err)
+	}
+}
+
+func TestPasswordAttemptLimiterWindow(t *testing.T) {
+	limiter := newTestPasswordAttemptLimiter(20 * time.Millisecond)
+	roomId := uuid.New()
+	for range 4 {
+		limiter.RecordFailure(1, roomId)
+	}
+	if !limiter.IsBlocked(1, roomId) {
+		t.Fatal("not blocked after reaching the limit")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if limiter.IsBlocked(1, roomId) {
+		t.Error("still blocked after the window")
+	}
+}
+
+func TestPasswordAttemptLimiterConcurrent(t *testing.T) {
+	limiter := NewPasswordAttemptLimiter(PasswordAttemptLimits{PerUserAndRoom: 100, PerUser: 100, PerRoom: 100}, time.Minute)
+	roomId := uuid.New()
+	var wg sync.WaitGroup
+	for userId := 1; userId <= 10; userId++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				limiter.IsBlocked(userId, roomId)
+				limiter.RecordFailure(userId, roomId)
+			}
+		}()
+	}
+	wg.Wait()
+	if limiter.Delay(roomId) == 0 {
+		t.Error("concurrent failures were lost")
+	}
+}
@@ -3,50 +3,62 @@ package service
 import (
 	. "chatroom-socket/internal/repository"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// SocketUser is a user in a room together with the connections of every device that joined it.
 type SocketUser struct {
-	User   User
-	Socket *websocket.Conn
+	User    User
+	Sockets map[uuid.UUID]*SocketConnection
 }
 
-func (user *SocketUser) SendMessage(socketMessage *SocketMessage) error {
-	if err := user.Socket.WriteJSON(socketMessage); err != nil {
-		return err
+// socketList copies the connections of the user. The caller holds the users lock of the room,
+// unless the user already left it.
+func (user *SocketUser) socketList() []*SocketConnection {
+	sockets := make([]*SocketConnection, 0, len(user.Sockets))
+	for _, socket := range user.Sockets {
+		sockets = append(sockets, socket)
 	}
-	return nil
+	return sockets
 }
 
 type SocketRoom struct {
-	Read           *Room
-	Users          map[int]*SocketUser
+	read           atomic.Pointer[Room] // Swapped whole when the room changes, never modified in place.
+	Users          map[int]*SocketUser  // Guarded by usersLock, together with the Sockets of every user.
 	MessageChannel chan *SocketMessage
 	RoomContext    context.Context
 	NumberOfPeople uint
+	Moderation     *RoomModeration
+	ready          atomic.Bool // Set once the bans and mutes are loaded. Joins are refused until then.
+	EmptySince     time.Time   // Zero while someone is in the room.
+	cancelContext  context.CancelFunc
+	sequence       uint64
+	history        []*SocketMessage // The latest RoomHistorySize broadcasts, kept for session resumption.
+	historyLock    *sync.Mutex
+	typing         map[int]*typingState
+	typingLock     *sync.Mutex
+	usersLock      *sync.RWMutex
 }
 
-func (service *RoomService) GetAllRoomViews() []RoomView {
-	var roomViews []RoomView
-	for _, room := range service.AllRooms {
-		roomViews = append(roomViews, RoomView{
-			Id:             room.Read.ID,
-			NumberOfPeople: room.NumberOfPeople,
-			RoomName:       room.Read.Name,
-			RoomType:       room.Read.RoomType,
-		})
-	}
-	return roomViews
+const RoomHistorySize = 256
+
+// Read returns the latest row of the room. Its ID never changes.
+func (room *SocketRoom) Read() *Room {
+	return room.read.Load()
 }
 
 func (room *SocketRoom) GetSocketUser(userId int) (*SocketUser, error) {
+	room.usersLock.RLock()
+	defer room.usersLock.RUnlock()
 	user, ok := room.Users[userId]
 	if !ok {
 		return nil, errors.New("socket not found")
@@ -54,43 +66,93 @@ func (room *SocketRoom) GetSocketUser(userId int) (*SocketUser, error) {
 	return user, nil
 }
 
+func (room *SocketRoom) HasUser(userId int) bool {
+	room.usersLock.RLock()
+	defer room.usersLock.RUnlock()
+	_, ok := room.Users[userId]
+	return ok
+}
+
+// connections copies the connections of everyone in the room but exceptUserId, so that sending
+// doesn't hold the users lock. User ids start at 1, so 0 keeps everyone.
+func (room *SocketRoom) connections(exceptUserId int) []*SocketConnection {
+	room.usersLock.RLock()
+	defer room.usersLock.RUnlock()
+	return room.unsafeConnections(exceptUserId)
+}
+
+func (room *SocketRoom) unsafeConnections(exceptUserId int) []*SocketConnection {
+	var sockets []*SocketConnection
+	for userId, user := range room.Users {
+		if userId != exceptUserId {
+			sockets = append(sockets, user.socketList()...)
+		}
+	}
+	return sockets
+}
+
+// SendToUser sends the message to every device the user joined the room with.
+func (room *SocketRoom) SendToUser(userId int, message *SocketMessage) error {
+	room.usersLock.RLock()
+	user, ok := room.Users[userId]
+	var sockets []*SocketConnection
+	if ok {
+		sockets = user.socketList()
+	}
+	room.usersLock.RUnlock()
+	if !ok {
+		return errors.New("socket not found")
+	}
+
+	encoded, err := EncodeSocketMessage(message)
+	if err != nil {
+		return err
+	}
+	var sendErrors []error
+	for _, socket := range sockets {
+		if err := socket.SendEncoded(encoded); err != nil {
+			sendErrors = append(sendErrors, err)
+		}
+	}
+	return errors.Join(sendErrors...)
+}
+
 func newRoom(read Room) *SocketRoom {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 	room := &SocketRoom{
-		Read:           &read,
 		Users:          make(map[int]*SocketUser),
 		MessageChannel: make(chan *SocketMessage),
 		RoomContext:    ctx,
-	}
-	log.Println(fmt.Sprintf("Listen message for broadcasting, room: %v", room.Read.ID))
+		Moderation:     newRoomModeration(),
+		EmptySince:     time.Now(),
+		cancelContext:  cancel,
+		history:        make([]*SocketMessage, 0, RoomHistorySize),
+		historyLock:    new(sync.Mutex),
+		typing:         make(map[int]*typingState),
+		typingLock:     new(sync.Mutex),
+		usersLock:      new(sync.RWMutex),
+	}
+	room.read.Store(&read)
+	log.Println(fmt.Sprintf("Listen message for broadcasting, room: %v", room.Read().ID))
 	go room.ListenMessage(ctx)
 	return room
 }
 
 func (room *SocketRoom) AllUsersLeave() {
-	notifyUserFunc := func(wg *sync.WaitGroup, user *SocketUser) {
-		defer wg.Done()
-		if err := user.Socket.WriteMessage(websocket.TextMessage, []byte("System calling for all user leave")); err != nil {
-			log.Println(err)
-		}
-		if err := user.Socket.Close(); err != nil {
+	room.usersLock.Lock()
+	sockets := room.unsafeConnections(0)
+	clear(room.Users)
+	room.NumberOfPeople = 0
+	room.EmptySince = time.Now()
+	room.usersLock.Unlock()
+
+	for _, socket := range sockets {
+		if err := socket.SendText("System calling for all user leave"); err != nil {
 			log.Println(err)
 		}
+		socket.Close()
 	}
-
-	wg := new(sync.WaitGroup)
-	numberOfUsers := len(room.Users)
-	wg.Add(numberOfUsers)
-	for _, user := range room.Users {
-		go notifyUserFunc(wg, user)
-	}
-
-	wg.Wait()
-
-	clear(room.Users)
-	close(room.MessageChannel)
-	room.NumberOfPeople = 0
-	room.RoomContext.Done()
+	room.cancelContext()
 }
 
 func (room *SocketRoom) BroadCastMessage(message *SocketMessage) {
@@ -101,10 +163,9 @@ func (room *SocketRoom) ListenMessage(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println(ctx.Err())
+			log.Println(fmt.Sprintf("Stop listening message of room %v: %v", room.Read().ID, ctx.Err()))
 			return
-		default:
-			message := <-room.MessageChannel
+		case message := <-room.MessageChannel:
 			room.broadcastMessage(message)
 		}
 	}
@@ -112,96 +173,303 @@ func (room *SocketRoom) ListenMessage(ctx context.Context) {
 
 func (room *SocketRoom) StopMessageListening() {
 	log.Println("Sending Done to room context")
-	room.RoomContext.Done()
+	room.cancelContext()
 }
 
+// broadcastMessage numbers the message and sends it to everyone in the room. The history lock is
+// held while sending so that clients receive the messages in sequence order.
 func (room *SocketRoom) broadcastMessage(message *SocketMessage) {
-	for _, user := range room.Users {
-		err := user.Socket.WriteJSON(message)
+	room.historyLock.Lock()
+	defer room.historyLock.Unlock()
+	room.sequence++
+	sequenced := *message
+	sequenced.Seq = room.sequence
+	if len(room.history) == RoomHistorySize {
+		room.history = append(room.history[:0], room.history[1:]...)
+	}
+	room.history = append(room.history, &sequenced)
+
+	encoded, err := EncodeSocketMessage(&sequenced)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, socket := range room.connections(0) {
+		err := socket.SendEncoded(encoded)
 		if err != nil {
 			continue
 		}
 	}
 }
 
-func (room *SocketRoom) UserJoin(socket *websocket.Conn, user User) error {
-	if _, ok := room.Users[user.ID]; ok {
-		return errors.New("user is already joined")
+// MessagesSince returns the broadcasts after lastSeq. It returns false when some of them
+// already fell out of the history.
+func (room *SocketRoom) MessagesSince(lastSeq uint64) ([]*SocketMessage, bool) {
+	room.historyLock.Lock()
+	defer room.historyLock.Unlock()
+	return room.unsafeMessagesSince(lastSeq)
+}
+
+func (room *SocketRoom) unsafeMessagesSince(lastSeq uint64) ([]*SocketMessage, bool) {
+	if lastSeq >= room.sequence {
+		return nil, true
 	}
-	socketUser := SocketUser{
-		User:   user,
-		Socket: socket,
+	if len(room.history) == 0 || room.history[0].Seq > lastSeq+1 {
+		return nil, false
 	}
+	offset := lastSeq + 1 - room.history[0].Seq
+	return slices.Clone(room.history[offset:]), true
+}
 
-	room.Users[user.ID] = &socketUser
+// ResumeConnection swaps the device of the user for its new connection and queues the broadcasts after
+// lastSeq on it. Holding the history lock keeps live broadcasts from overtaking the replay. complete is
+// false when some of the broadcasts already fell out of the history, in which case nothing is replayed.
+func (room *SocketRoom) ResumeConnection(userId int, oldConnectionId uuid.UUID, socket *SocketConnection, lastSeq uint64) (resumed bool, complete bool) {
+	room.historyLock.Lock()
+	defer room.historyLock.Unlock()
+	if !room.ReplaceConnection(userId, oldConnectionId, socket) {
+		return false, false
+	}
+	messages, complete := room.unsafeMessagesSince(lastSeq)
+	if !complete {
+		return true, false
+	}
+	for _, message := range messages {
+		if err := socket.Send(message); err != nil {
+			log.Println(fmt.Sprintf("unable to replay message %v of room %v: %v", message.Seq, room.Read().ID, err))
+			break
+		}
+	}
+	return true, true
+}
+
+// ReplaceConnection swaps a device of the user for its new connection without announcing anything to the room.
+func (room *SocketRoom) ReplaceConnection(userId int, oldConnectionId uuid.UUID, socket *SocketConnection) bool {
+	room.usersLock.Lock()
+	defer room.usersLock.Unlock()
+	socketUser, ok := room.Users[userId]
+	if !ok {
+		return false
+	}
+	if _, ok := socketUser.Sockets[oldConnectionId]; !ok {
+		return false
+	}
+	delete(socketUser.Sockets, oldConnectionId)
+	socketUser.Sockets[socket.Id] = socket
+	return true
+}
 
+// UserJoin adds the connections of the user to the room. Only the first device of a user
+// announces the join to the room.
+func (room *SocketRoom) UserJoin(sockets []*SocketConnection, user User) error {
+	isFirstDevice, err := room.addConnections(sockets, user)
+	if err != nil || !isFirstDevice {
+		return err
+	}
 	room.broadcastMessage(
 		NewSocketMessage(EventUserJoinRoom, fmt.Sprintf("User: %v joined room", user.UserName)),
 	)
+	return nil
+}
+
+func (room *SocketRoom) addConnections(sockets []*SocketConnection, user User) (isFirstDevice bool, err error) {
+	room.usersLock.Lock()
+	defer room.usersLock.Unlock()
+	if socketUser, ok := room.Users[user.ID]; ok {
+		added := 0
+		for _, socket := range sockets {
+			if _, joined := socketUser.Sockets[socket.Id]; !joined {
+				socketUser.Sockets[socket.Id] = socket
+				added++
+			}
+		}
+		if added == 0 {
+			return false, errors.New("user is already joined")
+		}
+		return false, nil
+	}
+	socketUser := SocketUser{
+		User:    user,
+		Sockets: make(map[uuid.UUID]*SocketConnection),
+	}
+	for _, socket := range sockets {
+		socketUser.Sockets[socket.Id] = socket
+	}
 
+	room.Users[user.ID] = &socketUser
 	room.NumberOfPeople++
-	return nil
+	room.EmptySince = time.Time{}
+	return true, nil
 }
 
 func (room *SocketRoom) UserLeave(user User) (*SocketUser, error) {
-	if _, ok := room.Users[user.ID]; !ok {
-		return nil, errors.New("user does not join any room")
+	socketUser, err := room.removeUser(user.ID)
+	if err != nil {
+		return nil, err
 	}
-	socketUser := room.Users[user.ID]
-	delete(room.Users, user.ID)
+	room.StopTyping(user)
 	room.broadcastMessage(
 		NewSocketMessage(EventUserJoinRoom, fmt.Sprintf("User: %v left room", user.UserName)),
 	)
+	return socketUser, nil
+}
+
+func (room *SocketRoom) removeUser(userId int) (*SocketUser, error) {
+	room.usersLock.Lock()
+	defer room.usersLock.Unlock()
+	socketUser, ok := room.Users[userId]
+	if !ok {
+		return nil, errors.New("user does not join any room")
+	}
+	delete(room.Users, userId)
 	room.NumberOfPeople--
+	if room.NumberOfPeople == 0 {
+		room.EmptySince = time.Now()
+	}
 	return socketUser, nil
 }
 
+// ConnectionLeave removes a single device of the user. The user leaves the room with their last device,
+// in which case left is true.
+func (room *SocketRoom) ConnectionLeave(user User, connectionId uuid.UUID) (left bool, err error) {
+	isLastDevice, err := room.removeConnection(user.ID, connectionId)
+	if err != nil || !isLastDevice {
+		return false, err
+	}
+	if _, err := room.UserLeave(user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeConnection drops the connection unless it is the last one of the user, which UserLeave takes care of.
+func (room *SocketRoom) removeConnection(userId int, connectionId uuid.UUID) (isLastDevice bool, err error) {
+	room.usersLock.Lock()
+	defer room.usersLock.Unlock()
+	socketUser, ok := room.Users[userId]
+	if !ok {
+		return false, errors.New("user does not join any room")
+	}
+	if _, ok := socketUser.Sockets[connectionId]; !ok {
+		return false, fmt.Errorf("connection %v did not join the room", connectionId)
+	}
+	if len(socketUser.Sockets) == 1 {
+		return true, nil
+	}
+	delete(socketUser.Sockets, connectionId)
+	return false, nil
+}
+
 type RoomService struct {
-	UserLocation       map[int]uuid.UUID
-	AllRooms           map[uuid.UUID]*SocketRoom
-	RoomServiceLock    *sync.Mutex
-	httpClient         *http.Client
-	chatRoomRepository IChatRoomRepository
+	UserLocation           map[int]uuid.UUID
+	AllRooms               map[uuid.UUID]*SocketRoom
+	RoomServiceLock        *sync.Mutex
+	httpClient             *http.Client
+	chatRoomRepository     IChatRoomRepository
+	chatMessageRepository  IChatMessageRepository
+	passwordAttemptLimiter *PasswordAttemptLimiter
+	lobby                  LobbyBroadcaster
+	presence               PresenceReader
 }
 
-func (service *RoomService) addRoomToCache(read Room) *SocketRoom {
+// PresenceReader tells whether a connected user is online or away.
+type PresenceReader interface {
+	getPresence(userId int) Presence
+}
+
+// SetPresenceReader lets room snapshots show who is away. Without it, connected users are shown online.
+func (service *RoomService) SetPresenceReader(presence PresenceReader) {
+	service.presence = presence
+}
 
+// LobbyBroadcaster reaches every connected user, including those who did not join any room.
+type LobbyBroadcaster interface {
+	SendNotification(message *SocketMessage)
+	SendMessageToUser(userId int, message *SocketMessage) error
+	IsConnected(userId int) bool
+}
+
+// addRoomToCache returns the cached room, creating it only when no other caller did it first.
+func (service *RoomService) addRoomToCache(read Room) *SocketRoom {
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
 	if cachedRoom, exists := service.AllRooms[read.ID]; exists {
 		return cachedRoom
 	}
 
 	room := newRoom(read)
-
-	service.RoomServiceLock.Lock()
-	defer service.RoomServiceLock.Unlock()
 	log.Println(fmt.Sprintf("Adding room cache: %v", read.ID))
 	service.AllRooms[read.ID] = room
+	go service.loadRoom(read.ID, room)
+	return room
+}
 
-	go func() {
-		err := service.UpdateRoom(context.Background(), read.ID)
-		if err != nil {
+const (
+	RoomModerationRetryDelay    = 2 * time.Second
+	RoomModerationMaxRetryDelay = time.Minute
+)
+
+// loadRoom refreshes the cached room and loads its bans and mutes, then opens the room to joins.
+// Loading is retried until it succeeds or the room is evicted, so that a database outage never
+// lets banned users in.
+func (service *RoomService) loadRoom(roomId uuid.UUID, room *SocketRoom) {
+	if err := service.UpdateRoom(room.RoomContext, roomId); err != nil {
+		log.Println(fmt.Sprintf("unable to refresh room %v: %v", roomId, err))
+	}
+	for attempt := 1; ; attempt++ {
+		err := service.loadRoomModeration(room.RoomContext, room)
+		if err == nil {
+			room.ready.Store(true)
 			return
 		}
-	}()
-
-	return room
+		log.Println(fmt.Sprintf("unable to load moderation of room %v, attempt %d: %v", roomId, attempt, err))
+		delay := min(time.Duration(attempt)*RoomModerationRetryDelay, RoomModerationMaxRetryDelay)
+		select {
+		case <-room.RoomContext.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
 }
 
-func (service *RoomService) removeRoomFromCache(read Room) {
+// removeRoomFromCache drops the room and the locations pointing at it. It returns false when the room
+// was already removed, or replaced by another SocketRoom, so that only one caller shuts it down.
+func (service *RoomService) removeRoomFromCache(room *SocketRoom) bool {
 	service.RoomServiceLock.Lock()
 	defer service.RoomServiceLock.Unlock()
-	log.Println(fmt.Sprintf("Removing room from cache: %v", read.ID))
-	delete(service.AllRooms, read.ID)
+	return service.unsafeRemoveRoomFromCache(room)
 }
 
-func NewRoomService(chatRoomRepository IChatRoomRepository) (*RoomService, error) {
+func (service *RoomService) unsafeRemoveRoomFromCache(room *SocketRoom) bool {
+	roomId := room.Read().ID
+	if cachedRoom, ok := service.AllRooms[roomId]; !ok || cachedRoom != room {
+		return false
+	}
+	log.Println(fmt.Sprintf("Removing room from cache: %v", roomId))
+	delete(service.AllRooms, roomId)
+	for userId, location := range service.UserLocation {
+		if location == roomId {
+			delete(service.UserLocation, userId)
+		}
+	}
+	return true
+}
 
+func NewRoomService(chatRoomRepository IChatRoomRepository, chatMessageRepository IChatMessageRepository, lobby LobbyBroadcaster) (*RoomService, error) {
+	passwordAttemptLimits := PasswordAttemptLimits{
+		PerUserAndRoom: MaxRoomPasswordAttempts,
+		PerUser:        MaxUserPasswordAttempts,
+		PerRoom:        MaxRoomPasswordFailures,
+	}
 	service := &RoomService{
-		chatRoomRepository: chatRoomRepository,
-		UserLocation:       make(map[int]uuid.UUID),
-		AllRooms:           make(map[uuid.UUID]*SocketRoom),
-		RoomServiceLock:    new(sync.Mutex),
-		httpClient:         http.DefaultClient,
+		chatRoomRepository:     chatRoomRepository,
+		chatMessageRepository:  chatMessageRepository,
+		UserLocation:           make(map[int]uuid.UUID),
+		AllRooms:               make(map[uuid.UUID]*SocketRoom),
+		RoomServiceLock:        new(sync.Mutex),
+		httpClient:             http.DefaultClient,
+		passwordAttemptLimiter: NewPasswordAttemptLimiter(passwordAttemptLimits, RoomPasswordAttemptWindow),
+		lobby:                  lobby,
 	}
 	rooms, err := service.chatRoomRepository.GetAllRooms()
 	if err != nil {
@@ -216,14 +484,21 @@ func NewRoomService(chatRoomRepository IChatRoomRepository) (*RoomService, error
 }
 
 func (service *RoomService) GetRoom(roomId uuid.UUID) (*SocketRoom, error) {
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
+	return service.unsafeGetRoom(roomId)
+}
+
+func (service *RoomService) unsafeGetRoom(roomId uuid.UUID) (*SocketRoom, error) {
 	if room, ok := service.AllRooms[roomId]; ok {
 		return room, nil
 	}
-	return nil, errors.New("room not found")
+	return nil, fmt.Errorf("%w: %v", ErrRoomNotFound, roomId)
 }
 
 func (service *RoomService) GetUserLocation(userId int) (uuid.UUID, error) {
-
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
 	roomId, ok := service.UserLocation[userId]
 	if !ok {
 		return uuid.Nil, errors.New(fmt.Sprintf("user: %v did not join any room", userId))
@@ -235,8 +510,10 @@ func (service *RoomService) GetUserLocation(userId int) (uuid.UUID, error) {
 func (service *RoomService) GetAllRooms() []Room {
 	var rooms []Room
 
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
 	for _, room := range service.AllRooms {
-		rooms = append(rooms, *room.Read)
+		rooms = append(rooms, *room.Read())
 	}
 
 	return rooms
@@ -246,33 +523,108 @@ func (service *RoomService) GetChatRoomSettings(ctx context.Context, roomId uuid
 	return service.chatRoomRepository.GetRoomSettings(ctx, roomId)
 }
 
-func (service *RoomService) UserJoinRoom(roomId uuid.UUID, user User, socket *websocket.Conn) error {
+func (service *RoomService) verifyRoomPassword(ctx context.Context, room *SocketRoom, user User, password string) error {
+	roomId := room.Read().ID
+	if service.passwordAttemptLimiter.IsBlocked(user.ID, roomId) {
+		return ErrTooManyPasswordAttempts
+	}
+	if len(password) == 0 {
+		return ErrRoomPasswordRequired
+	}
+	if delay := service.passwordAttemptLimiter.Delay(roomId); delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	settings, err := service.chatRoomRepository.GetRoomSettings(ctx, roomId)
+	if err != nil {
+		return err
+	}
+	if settings.Password == nil {
+		return fmt.Errorf("room %v has no password configured", roomId)
+	}
+	if err := CompareRoomPassword(*settings.Password, password); err != nil {
+		if errors.Is(err, ErrWrongRoomPassword) {
+			log.Println(fmt.Sprintf("user %v entered wrong password for room %v", user.UserName, roomId))
+			service.passwordAttemptLimiter.RecordFailure(user.ID, roomId)
+		}
+		return err
+	}
+	service.passwordAttemptLimiter.Reset(user.ID, roomId)
+	if !IsRoomPasswordHash(*settings.Password) {
+		service.rehashRoomPassword(ctx, roomId, *settings.Password, password)
+	}
+	return nil
+}
+
+// rehashRoomPassword replaces a plaintext password left by the admin service with its hash.
+// Failures are only logged because the password was verified anyway.
+func (service *RoomService) rehashRoomPassword(ctx context.Context, roomId uuid.UUID, storedPassword string, password string) {
+	hashedPassword, err := HashRoomPassword(password)
+	if err != nil {
+		log.Println(fmt.Sprintf("unable to hash password of room %v: %v", roomId, err))
+		return
+	}
+	if err := service.chatRoomRepository.UpdateRoomPassword(ctx, roomId, storedPassword, hashedPassword); err != nil {
+		log.Println(fmt.Sprintf("unable to rehash password of room %v: %v", roomId, err))
+		return
+	}
+	log.Println(fmt.Sprintf("rehashed plaintext password of room %v", roomId))
+}
+
+// UserJoinRoom puts the given connections of the user in the room. A user is in one room at a time,
+// so joining another room moves them out of the previous one with all their devices.
+func (service *RoomService) UserJoinRoom(ctx context.Context, roomId uuid.UUID, user User, sockets []*SocketConnection, credentials JoinRoomCredentials) error {
+	room, err := service.GetRoom(roomId)
+	if err != nil {
+		return err
+	}
+	if err := service.authorizeRoomJoin(ctx, room, user, credentials); err != nil {
+		return err
+	}
+	if err := service.joinRoom(roomId, user, sockets); err != nil {
+		return err
+	}
+	service.sendRoomSnapshot(ctx, room, user.ID)
+	return nil
+}
+
+func (service *RoomService) joinRoom(roomId uuid.UUID, user User, sockets []*SocketConnection) error {
 	service.RoomServiceLock.Lock()
-	func() {
+	defer func() {
 		fmt.Println("Unlocking the service lock")
 		service.RoomServiceLock.Unlock()
 	}()
 
-	if err := service.UnsafeUserJoinRoom(roomId, user, socket); err != nil {
+	if err := service.UnsafeUserJoinRoom(roomId, user, sockets); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (service *RoomService) UnsafeUserJoinRoom(roomId uuid.UUID, user User, socket *websocket.Conn) error {
-	if joinedRoomId, ok := service.UserLocation[user.ID]; ok {
+func (service *RoomService) UnsafeUserJoinRoom(roomId uuid.UUID, user User, sockets []*SocketConnection) error {
+	room, err := service.unsafeGetRoom(roomId)
+	if err != nil {
+		return err
+	}
+	if !room.ready.Load() {
+		return fmt.Errorf("%w: %v", ErrRoomNotReady, roomId)
+	}
+	if room.Moderation.IsBanned(user.ID) {
+		return fmt.Errorf("%w: %v", ErrUserBanned, roomId)
+	}
+
+	if joinedRoomId, ok := service.UserLocation[user.ID]; ok && joinedRoomId != roomId {
 		log.Println(fmt.Sprintf("User %v already joined room %v", user.UserName, joinedRoomId))
 		if _, err := service.UnsafeUserLeaveRoom(user); err != nil {
 			return err
 		}
 	}
 
-	room, err := service.GetRoom(roomId)
-	if err != nil {
-		return fmt.Errorf("room %s does not exist", roomId)
-	}
-
-	if err := room.UserJoin(socket, user); err != nil {
+	if err := room.UserJoin(sockets, user); err != nil {
 		return err
 	}
 	service.UserLocation[user.ID] = roomId
@@ -287,7 +639,7 @@ func (service *RoomService) UnsafeUserLeaveRoom(user User) (*SocketUser, error)
 		return nil, errors.New("user is not joined any room")
 	}
 
-	room, err := service.GetRoom(userLocationRoomId)
+	room, err := service.unsafeGetRoom(userLocationRoomId)
 	if err != nil {
 		return nil, fmt.Errorf("room %s does not exist", userLocationRoomId)
 	}
@@ -314,9 +666,32 @@ func (service *RoomService) UserLeaveRoom(user User) (*SocketUser, error) {
 	return socketUser, nil
 }
 
-func (service *RoomService) UserSwitchRoom(user User, targetRoomId uuid.UUID) error {
+// ConnectionLeaveRoom takes one device of the user out of their room, as when that device disconnects.
+func (service *RoomService) ConnectionLeaveRoom(user User, connectionId uuid.UUID) error {
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
+	roomId, ok := service.UserLocation[user.ID]
+	if !ok {
+		return errors.New("user is not joined any room")
+	}
+	room, err := service.unsafeGetRoom(roomId)
+	if err != nil {
+		return err
+	}
+	left, err := room.ConnectionLeave(user, connectionId)
+	if err != nil {
+		return err
+	}
+	if left {
+		delete(service.UserLocation, user.ID)
+		log.Println(fmt.Sprintf("user %v left room: %v", user.UserName, roomId))
+	}
+	return nil
+}
+
+func (service *RoomService) UserSwitchRoom(ctx context.Context, user User, targetRoomId uuid.UUID, credentials JoinRoomCredentials) error {
 	log.Println(fmt.Sprintf("User: %v switch room to %v", user.UserName, targetRoomId))
-	_, err := service.GetRoom(targetRoomId)
+	targetRoom, err := service.GetRoom(targetRoomId)
 	if err != nil {
 		return err
 	}
@@ -330,7 +705,26 @@ func (service *RoomService) UserSwitchRoom(user User, targetRoomId uuid.UUID) er
 		return errors.New("target room is already joined")
 	}
 
-	socketUser, err := service.UserLeaveRoom(user)
+	if err := service.authorizeRoomJoin(ctx, targetRoom, user, credentials); err != nil {
+		return err
+	}
+	if err := service.switchRoom(user, roomId, targetRoomId); err != nil {
+		return err
+	}
+	service.sendRoomSnapshot(ctx, targetRoom, user.ID)
+	return nil
+}
+
+// switchRoom moves the user with all their devices from one room to the other under one lock, so
+// that nobody sees the user in neither room. The user goes back to the source room when the join fails.
+func (service *RoomService) switchRoom(user User, sourceRoomId uuid.UUID, targetRoomId uuid.UUID) error {
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
+
+	if roomId, ok := service.UserLocation[user.ID]; !ok || roomId != sourceRoomId {
+		return fmt.Errorf("user left room %v while switching", sourceRoomId)
+	}
+	socketUser, err := service.UnsafeUserLeaveRoom(user)
 	if err != nil {
 		log.Println(err.Error())
 		return err
@@ -338,11 +732,15 @@ func (service *RoomService) UserSwitchRoom(user User, targetRoomId uuid.UUID) er
 	if socketUser == nil {
 		return errors.New("socket user is not found, consider establish a new socket connection")
 	}
-	err = service.UserJoinRoom(targetRoomId, socketUser.User, socketUser.Socket)
-	if err != nil {
-		return err
+	sockets := socketUser.socketList()
+	err = service.UnsafeUserJoinRoom(targetRoomId, socketUser.User, sockets)
+	if err == nil {
+		return nil
 	}
-	return nil
+	if rejoinErr := service.UnsafeUserJoinRoom(sourceRoomId, socketUser.User, sockets); rejoinErr != nil {
+		log.Println(fmt.Sprintf("unable to return user %v to room %v: %v", user.UserName, sourceRoomId, rejoinErr))
+	}
+	return err
 }
 
 func (service *RoomService) validateAddRomSchema(schema *AddRoomSchema) error {
@@ -372,6 +770,9 @@ func (service *RoomService) validateAddRomSchema(schema *AddRoomSchema) error {
 	if schema.RoomType == RoomTypePrivate && len(schema.RoomPassword) == 0 {
 		return errors.New("room_password is required for private room")
 	}
+	if schema.IsEphemeral && schema.IdleTtlSeconds <= 0 {
+		return errors.New("idle_ttl_seconds must be positive for ephemeral room")
+	}
 	return nil
 }
 
@@ -387,45 +788,171 @@ func (service *RoomService) CreateNewRoom(ctx context.Context, addRoomSchema *Ad
 		return nil, err
 	}
 
+	if addRoomSchema.RoomType == RoomTypePrivate {
+		hashedPassword, err := HashRoomPassword(addRoomSchema.RoomPassword)
+		if err != nil {
+			return nil, err
+		}
+		addRoomSchema.RoomPassword = hashedPassword
+	}
+
 	_newRoom, err := service.chatRoomRepository.CreateNewRoom(ctx, addRoomSchema)
 	if err != nil {
 		return nil, err
 	}
+	if err := service.chatRoomRepository.AddRoomMember(ctx, _newRoom.ID, addRoomSchema.OwnerId, nil, RoomJoinDirect); err != nil {
+		log.Println(fmt.Sprintf("unable to add owner %v as member of room %v: %v", addRoomSchema.OwnerId, _newRoom.ID, err))
+	}
+	if addRoomSchema.IsEphemeral {
+		if err := service.chatRoomRepository.SaveEphemeralRoom(ctx, _newRoom.ID, addRoomSchema.IdleTtlSeconds); err != nil {
+			return nil, err
+		}
+		_newRoom.IdleTtlSeconds = &addRoomSchema.IdleTtlSeconds
+	}
 	cachedRoom := service.addRoomToCache(*_newRoom)
 	return cachedRoom, nil
 }
 
 func (service *RoomService) DeleteRoom(ctx context.Context, userId int, roomId uuid.UUID) error {
-	room, err := service.GetRoom(roomId)
+	room, err := service.getOwnedRoom(roomId, userId)
+	if err != nil {
+		return err
+	}
+	return service.deleteRoom(ctx, room)
+}
+
+func (service *RoomService) deleteRoom(ctx context.Context, room *SocketRoom) error {
+	err := service.chatRoomRepository.DeleteRoom(ctx, room.Read().ID)
 	if err != nil {
 		return err
 	}
+	return service.evictRoom(room)
+}
 
-	if room.Read.OwnerId != userId {
-		return errors.New(fmt.Sprintf("room %v does not own user %v", roomId, userId))
+// evictRoom stops the room, disconnects its users and tells the lobby that the room is gone.
+// Evicting a room that is not cached anymore does nothing.
+func (service *RoomService) evictRoom(room *SocketRoom) error {
+	if !service.removeRoomFromCache(room) {
+		return nil
 	}
+	return service.shutdownRoom(room)
+}
+
+// shutdownRoom stops a room that was already removed from the cache.
+func (service *RoomService) shutdownRoom(room *SocketRoom) error {
+	roomId := room.Read().ID
 	room.StopMessageListening()
-	err = service.chatRoomRepository.DeleteRoom(ctx, roomId)
+	room.AllUsersLeave()
+
+	body, err := json.Marshal(map[string]any{"room_id": roomId})
 	if err != nil {
 		return err
 	}
-	room.AllUsersLeave()
-	service.removeRoomFromCache(*room.Read)
+	service.lobby.SendNotification(NewSocketMessage(EventRoomRemoved, string(body)))
 	return nil
 }
 
+type UpdateRoomSchema struct {
+	Name          *string   `json:"name"`
+	RoomType      *RoomType `json:"room_type"`
+	RoomPassword  *string   `json:"room_password"`
+	AssistantRule *string   `json:"assistant_rule"`
+}
+
+// EditRoom applies the fields set in the schema, validates the result like a new room
+// and broadcasts the new settings to everyone in the room.
+func (service *RoomService) EditRoom(ctx context.Context, userId int, roomId uuid.UUID, schema *UpdateRoomSchema) (*SocketRoom, *ChatRoomSettings, error) {
+	room, err := service.getOwnedRoom(roomId, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := service.chatRoomRepository.GetRoomSettings(ctx, roomId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mergedSchema := &AddRoomSchema{
+		Id:         roomId,
+		Name:       room.Read().Name,
+		OwnerId:    userId,
+		RoomType:   settings.RoomType,
+		SettingsId: settings.ID,
+	}
+	if settings.Password != nil {
+		mergedSchema.RoomPassword = *settings.Password
+	}
+	if schema.Name != nil {
+		mergedSchema.Name = *schema.Name
+	}
+	if schema.RoomType != nil {
+		mergedSchema.RoomType = *schema.RoomType
+	}
+	if schema.RoomPassword != nil {
+		mergedSchema.RoomPassword = *schema.RoomPassword
+	}
+	if err := service.validateAddRomSchema(mergedSchema); err != nil {
+		return nil, nil, err
+	}
+
+	previousPassword, previousRoomType := settings.Password, settings.RoomType
+	settings.RoomType = mergedSchema.RoomType
+	if schema.AssistantRule != nil {
+		settings.AssistantRule = *schema.AssistantRule
+	}
+	switch {
+	case settings.RoomType != RoomTypePrivate:
+		settings.Password = nil
+	case schema.RoomPassword != nil:
+		hashedPassword, err := HashRoomPassword(*schema.RoomPassword)
+		if err != nil {
+			return nil, nil, err
+		}
+		settings.Password = &hashedPassword
+	}
+
+	if err := service.chatRoomRepository.UpdateRoomSettings(ctx, roomId, mergedSchema.Name, settings); err != nil {
+		return nil, nil, err
+	}
+	if previousPassword != nil && (settings.Password == nil || *settings.Password != *previousPassword) {
+		if err := service.revokePasswordMembers(ctx, roomId); err != nil {
+			return nil, nil, err
+		}
+	}
+	if previousRoomType != RoomTypePrivate && settings.RoomType == RoomTypePrivate {
+		if err := service.revokeUninvitedMembers(ctx, room.Read()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := service.UpdateRoom(ctx, roomId); err != nil {
+		return nil, nil, err
+	}
+	log.Println(fmt.Sprintf("user %v updated room %v", userId, roomId))
+
+	body, err := json.Marshal(map[string]any{
+		"room":     room.Read(),
+		"settings": settings,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	room.broadcastMessage(NewSocketMessage(EventRoomSettingsUpdated, string(body)))
+	return room, settings, nil
+}
+
 func (service *RoomService) UpdateRoom(ctx context.Context, roomId uuid.UUID) error {
 	log.Println(fmt.Sprintf("Update room %v", roomId))
 	room, err := service.chatRoomRepository.GetRoomById(ctx, roomId)
 	if err != nil {
 		return err
 	}
+	service.RoomServiceLock.Lock()
+	defer service.RoomServiceLock.Unlock()
 	socketRoom, ok := service.AllRooms[room.ID]
 	if !ok {
 		return errors.New(fmt.Sprintf("room %v does not exist", room.ID))
 	}
 
-	socketRoom.Read = room
+	socketRoom.read.Store(room)
 	return nil
 
 }
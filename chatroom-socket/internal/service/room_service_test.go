@@ -0,0 +1,462 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestConnection creates a v1 connection without a websocket. Sent messages stay in its queue.
+func newTestConnection() *SocketConnection {
+	config := DefaultSocketConfig()
+	return &SocketConnection{
+		Id:        uuid.New(),
+		Version:   ProtocolV1,
+		config:    config,
+		send:      make(chan outboundFrame, config.SendQueueSize),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+		lastSeen:  new(atomic.Int64),
+	}
+}
+
+// receivedMessages drains the queue of the connection.
+func receivedMessages(t *testing.T, connection *SocketConnection) []SocketMessage {
+	t.Helper()
+	var messages []SocketMessage
+	for {
+		select {
+		case frame := <-connection.send:
+			var message SocketMessage
+			if err := json.Unmarshal(frame.data, &message); err != nil {
+				t.Fatalf("unable to decode %q: %v", frame.data, err)
+			}
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func countEvents(messages []SocketMessage, event EventType) int {
+	count := 0
+	for _, message := range messages {
+		if message.Event == event {
+			count++
+		}
+	}
+	return count
+}
+
+func newTestSocketRoom(t *testing.T) *SocketRoom {
+	room := newRoom(Room{ID: uuid.New(), Name: "test", RoomType: RoomTypePublic})
+	t.Cleanup(room.StopMessageListening)
+	return room
+}
+
+func TestUserJoinMultipleDevices(t *testing.T) {
+	room := newTestSocketRoom(t)
+	user := User{ID: 1, UserName: "alice"}
+	phone, laptop := newTestConnection(), newTestConnection()
+
+	if err := room.UserJoin([]*SocketConnection{phone}, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UserJoin([]*SocketConnection{laptop}, user); err != nil {
+		t.Fatalf("second device: %v", err)
+	}
+	if err := room.UserJoin([]*SocketConnection{laptop}, user); err == nil {
+		t.Error("joining twice with the same device succeeded")
+	}
+	if room.NumberOfPeople != 1 {
+		t.Errorf("number of people: got %d, want 1", room.NumberOfPeople)
+	}
+	if joins := countEvents(receivedMessages(t, phone), EventUserJoinRoom); joins != 1 {
+		t.Errorf("second device announced the join again: %d join broadcasts", joins)
+	}
+
+	room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, "hello"))
+	for name, device := range map[string]*SocketConnection{"phone": phone, "laptop": laptop} {
+		if messages := countEvents(receivedMessages(t, device), EventRoomSendMessage); messages != 1 {
+			t.Errorf("%v got %d messages, want 1", name, messages)
+		}
+	}
+}
+
+func TestConnectionLeaveLastDevice(t *testing.T) {
+	room := newTestSocketRoom(t)
+	user := User{ID: 1, UserName: "alice"}
+	observer := newTestConnection()
+	phone, laptop := newTestConnection(), newTestConnection()
+	if err := room.UserJoin([]*SocketConnection{observer}, User{ID: 2, UserName: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UserJoin([]*SocketConnection{phone, laptop}, user); err != nil {
+		t.Fatal(err)
+	}
+	for _, connection := range []*SocketConnection{observer, phone, laptop} {
+		receivedMessages(t, connection)
+	}
+
+	if _, err := room.ConnectionLeave(user, uuid.New()); err == nil {
+		t.Error("unknown connection left the room")
+	}
+	left, err := room.ConnectionLeave(user, laptop.Id)
+	if err != nil || left {
+		t.Fatalf("first device: got left %v, %v", left, err)
+	}
+	if !room.HasUser(user.ID) {
+		t.Fatal("user left with a device to spare")
+	}
+	room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, "hello"))
+	if len(receivedMessages(t, laptop)) != 0 {
+		t.Error("device that left still gets broadcasts")
+	}
+	if len(receivedMessages(t, phone)) != 1 {
+		t.Error("remaining device missed the broadcast")
+	}
+
+	left, err = room.ConnectionLeave(user, phone.Id)
+	if err != nil || !left {
+		t.Fatalf("last device: got left %v, %v", left, err)
+	}
+	if room.HasUser(user.ID) || room.NumberOfPeople != 1 {
+		t.Errorf("user still in the room with %d people", room.NumberOfPeople)
+	}
+	// One broadcast for the message above, one for the leave.
+	if messages := receivedMessages(t, observer); len(messages) != 2 {
+		t.Errorf("observer got %d broadcasts, want 2", len(messages))
+	}
+}
+
+func TestRoomConcurrentDevices(t *testing.T) {
+	room := newTestSocketRoom(t)
+	var wg sync.WaitGroup
+	for userId := 1; userId <= 10; userId++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := User{ID: userId, UserName: fmt.Sprintf("user%d", userId)}
+			first, second := newTestConnection(), newTestConnection()
+			if err := room.UserJoin([]*SocketConnection{first}, user); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := room.UserJoin([]*SocketConnection{second}, user); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := room.ConnectionLeave(user, first.Id); err != nil {
+				t.Error(err)
+			}
+			if _, err := room.ConnectionLeave(user, second.Id); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, "hello"))
+		}
+	}()
+	wg.Wait()
+
+	if room.NumberOfPeople != 0 || len(room.Users) != 0 || room.EmptySince.IsZero() {
+		t.Errorf("room not empty: %d people, %d users", room.NumberOfPeople, len(room.Users))
+	}
+}
+
+func TestTypingBroadcast(t *testing.T) {
+	room := newTestSocketRoom(t)
+	alice, bob := User{ID: 1, UserName: "alice"}, User{ID: 2, UserName: "bob"}
+	aliceConnection, bobConnection := newTestConnection(), newTestConnection()
+	if err := room.UserJoin([]*SocketConnection{aliceConnection}, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UserJoin([]*SocketConnection{bobConnection}, bob); err != nil {
+		t.Fatal(err)
+	}
+	receivedMessages(t, aliceConnection)
+	receivedMessages(t, bobConnection)
+
+	room.StartTyping(alice)
+	room.StartTyping(alice)
+	room.StopTyping(alice)
+	room.StopTyping(alice)
+
+	messages := receivedMessages(t, bobConnection)
+	if started, stopped := countEvents(messages, EventTypingStarted), countEvents(messages, EventTypingStopped); started != 1 || stopped != 1 {
+		t.Errorf("got %d typing_started and %d typing_stopped, want 1 each", started, stopped)
+	}
+	if len(receivedMessages(t, aliceConnection)) != 0 {
+		t.Error("typing events were echoed to the typist")
+	}
+}
+
+func TestTypingConcurrentLeave(t *testing.T) {
+	room := newTestSocketRoom(t)
+	var wg sync.WaitGroup
+	for userId := 1; userId <= 10; userId++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := User{ID: userId, UserName: fmt.Sprintf("user%d", userId)}
+			if err := room.UserJoin([]*SocketConnection{newTestConnection()}, user); err != nil {
+				t.Error(err)
+				return
+			}
+			room.StartTyping(user)
+			if _, err := room.UserLeave(user); err != nil {
+				t.Error(err)
+			}
+			room.StopTyping(user)
+		}()
+	}
+	wg.Wait()
+
+	room.typingLock.Lock()
+	defer room.typingLock.Unlock()
+	if len(room.typing) != 0 {
+		t.Errorf("%d typing states outlived their users", len(room.typing))
+	}
+}
+
+func TestMessagesSinceWraparound(t *testing.T) {
+	room := newTestSocketRoom(t)
+	if messages, complete := room.MessagesSince(0); len(messages) != 0 || !complete {
+		t.Errorf("empty room: got %d messages, complete %v", len(messages), complete)
+	}
+
+	total := RoomHistorySize + 10
+	for i := 1; i <= total; i++ {
+		room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, fmt.Sprint(i)))
+	}
+	oldestSeq := uint64(total - RoomHistorySize + 1)
+
+	if messages, complete := room.MessagesSince(0); messages != nil || complete {
+		t.Errorf("evicted broadcasts: got %d messages, complete %v", len(messages), complete)
+	}
+	if _, complete := room.MessagesSince(oldestSeq - 2); complete {
+		t.Error("broadcast right before the history reported as complete")
+	}
+	messages, complete := room.MessagesSince(oldestSeq - 1)
+	if !complete || len(messages) != RoomHistorySize || messages[0].Seq != oldestSeq {
+		t.Errorf("whole history: got %d messages, complete %v", len(messages), complete)
+	}
+	messages, complete = room.MessagesSince(uint64(total - 3))
+	if !complete || len(messages) != 3 {
+		t.Fatalf("latest broadcasts: got %d messages, complete %v", len(messages), complete)
+	}
+	for i, message := range messages {
+		if want := uint64(total - 2 + i); message.Seq != want || message.Content != fmt.Sprint(want) {
+			t.Errorf("message %d: got seq %d content %q, want %d", i, message.Seq, message.Content, want)
+		}
+	}
+	if messages, complete := room.MessagesSince(uint64(total)); messages != nil || !complete {
+		t.Errorf("up to date: got %d messages, complete %v", len(messages), complete)
+	}
+}
+
+func TestResumeConnectionReplaysInOrder(t *testing.T) {
+	room := newTestSocketRoom(t)
+	user := User{ID: 1, UserName: "alice"}
+	oldConnection, newConnection := newTestConnection(), newTestConnection()
+	if err := room.UserJoin([]*SocketConnection{oldConnection}, user); err != nil {
+		t.Fatal(err)
+	}
+	lastSeq := receivedMessages(t, oldConnection)[0].Seq
+	for range 3 {
+		room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, "missed"))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			room.broadcastMessage(NewSocketMessage(EventRoomSendMessage, "live"))
+		}
+	}()
+	resumed, complete := room.ResumeConnection(user.ID, oldConnection.Id, newConnection, lastSeq)
+	wg.Wait()
+	if !resumed || !complete {
+		t.Fatalf("got resumed %v, complete %v", resumed, complete)
+	}
+
+	messages := receivedMessages(t, newConnection)
+	if len(messages) < 3 {
+		t.Fatalf("got %d messages, want the 3 missed ones at least", len(messages))
+	}
+	for i, message := range messages {
+		if want := lastSeq + uint64(i) + 1; message.Seq != want {
+			t.Fatalf("message %d: got seq %d, want %d", i, message.Seq, want)
+		}
+	}
+	if resumed, _ := room.ResumeConnection(user.ID, oldConnection.Id, newTestConnection(), lastSeq); resumed {
+		t.Error("replaced connection resumed again")
+	}
+}
+
+func TestRoomCacheConcurrentAccess(t *testing.T) {
+	service := newTestRoomService(newFakeChatRoomRepository())
+	first := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	second := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	evicted := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	roomIds := []uuid.UUID{first.Read().ID, second.Read().ID, evicted.Read().ID}
+
+	var wg sync.WaitGroup
+	for userId := 1; userId <= 10; userId++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := User{ID: userId, UserName: fmt.Sprintf("user%d", userId)}
+			for i := range 20 {
+				// Joins of the evicted room fail once it is gone.
+				_ = service.joinRoom(roomIds[(userId+i)%len(roomIds)], user, []*SocketConnection{newTestConnection()})
+				service.GetUserLocation(user.ID)
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			for _, room := range service.GetAllRooms() {
+				if _, err := service.GetRoom(room.ID); err != nil && room.ID != evicted.Read().ID {
+					t.Error(err)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			read := *first.Read()
+			if err := service.applyRoomRead(context.Background(), read.ID, &read); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := service.evictRoom(evicted); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+
+	if _, err := service.GetRoom(evicted.Read().ID); err == nil {
+		t.Error("evicted room is still cached")
+	}
+	for userId := 1; userId <= 10; userId++ {
+		if roomId, err := service.GetUserLocation(userId); err == nil && roomId == evicted.Read().ID {
+			t.Errorf("user %d is still located in the evicted room", userId)
+		}
+	}
+}
+
+// loadingChatRoomRepository hands out the sanctions of a room one load attempt at a time.
+type loadingChatRoomRepository struct {
+	*fakeChatRoomRepository
+	read      Room
+	sanctions chan error // A nil error loads a ban of bannedUserId.
+}
+
+const bannedUserId = 2
+
+func (repository *loadingChatRoomRepository) GetRoomById(ctx context.Context, roomId uuid.UUID) (*Room, error) {
+	read := repository.read
+	return &read, nil
+}
+
+func (repository *loadingChatRoomRepository) GetActiveRoomSanctions(ctx context.Context, roomId uuid.UUID) ([]RoomSanction, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-repository.sanctions:
+		if err != nil {
+			return nil, err
+		}
+		return []RoomSanction{{RoomId: roomId, UserId: bannedUserId, SanctionType: SanctionTypeBan}}, nil
+	}
+}
+
+func TestRoomRefusesJoinsUntilModerationLoads(t *testing.T) {
+	ownerId := testOwnerId
+	repository := &loadingChatRoomRepository{
+		fakeChatRoomRepository: newFakeChatRoomRepository(),
+		read:                   Room{ID: uuid.New(), Name: "test", OwnerId: &ownerId, RoomType: RoomTypePublic},
+		sanctions:              make(chan error),
+	}
+	service := newTestRoomService(repository)
+	room := service.addRoomToCache(repository.read)
+	t.Cleanup(room.StopMessageListening)
+	roomId := room.Read().ID
+	banned, other := User{ID: bannedUserId, UserName: "banned"}, User{ID: 3, UserName: "other"}
+
+	for _, user := range []User{banned, other} {
+		if err := service.joinRoom(roomId, user, []*SocketConnection{newTestConnection()}); !errors.Is(err, ErrRoomNotReady) {
+			t.Errorf("user %d joined while loading: got %v, want %v", user.ID, err, ErrRoomNotReady)
+		}
+	}
+
+	// A failed load keeps the room cached and closed.
+	repository.sanctions <- errors.New("connection refused")
+	if _, err := service.GetRoom(roomId); err != nil {
+		t.Fatalf("room evicted after a failed load: %v", err)
+	}
+	if err := service.joinRoom(roomId, banned, []*SocketConnection{newTestConnection()}); !errors.Is(err, ErrRoomNotReady) {
+		t.Errorf("join after a failed load: got %v, want %v", err, ErrRoomNotReady)
+	}
+
+	repository.sanctions <- nil
+	for deadline := time.Now().Add(time.Second); !room.ready.Load(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("room not ready after loading")
+		}
+	}
+	if err := service.joinRoom(roomId, banned, []*SocketConnection{newTestConnection()}); !errors.Is(err, ErrUserBanned) {
+		t.Errorf("banned user: got %v, want %v", err, ErrUserBanned)
+	}
+	if err := service.joinRoom(roomId, other, []*SocketConnection{newTestConnection()}); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+}
+
+func TestUserSwitchRoomReturnsOnFailedJoin(t *testing.T) {
+	service := newTestRoomService(newFakeChatRoomRepository())
+	source := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	target := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	loading := newRoom(Room{ID: uuid.New(), Name: "loading", RoomType: RoomTypePublic})
+	t.Cleanup(loading.StopMessageListening)
+	service.AllRooms[loading.Read().ID] = loading
+	user := User{ID: 2, UserName: "bob"}
+	phone, laptop := newTestConnection(), newTestConnection()
+	if err := service.joinRoom(source.Read().ID, user, []*SocketConnection{phone, laptop}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := service.UserSwitchRoom(ctx, user, loading.Read().ID, JoinRoomCredentials{}); !errors.Is(err, ErrRoomNotReady) {
+		t.Fatalf("switch to a loading room: got %v, want %v", err, ErrRoomNotReady)
+	}
+	if roomId, _ := service.GetUserLocation(user.ID); roomId != source.Read().ID {
+		t.Errorf("user not returned to the source room: located in %v", roomId)
+	}
+	if socketUser, err := source.GetSocketUser(user.ID); err != nil || len(socketUser.Sockets) != 2 {
+		t.Errorf("devices not returned to the source room: %v", err)
+	}
+
+	if err := service.UserSwitchRoom(ctx, user, target.Read().ID, JoinRoomCredentials{}); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if roomId, _ := service.GetUserLocation(user.ID); roomId != target.Read().ID || source.HasUser(user.ID) || !target.HasUser(user.ID) {
+		t.Errorf("user not moved to the target room: located in %v", roomId)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+const RoomSnapshotMessageLimit = 50
+
+func (service *RoomService) GetRoomSnapshot(ctx context.Context, room *SocketRoom) (*RoomSnapshot, error) {
+	roomId := room.Read().ID
+	settings, err := service.chatRoomRepository.GetRoomSettings(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	members, err := service.chatRoomRepository.GetRoomMembers(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := service.chatMessageRepository.GetAllMessagesByRoomId(roomId, 0, RoomSnapshotMessageLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	memberViews := make([]RoomMemberView, 0, len(members))
+	for _, member := range members {
+		memberViews = append(memberViews, RoomMemberView{RoomMember: member, Presence: service.getMemberPresence(room, member.UserId)})
+	}
+
+	return &RoomSnapshot{
+		Room:     room.Read(),
+		Settings: settings,
+		Members:  memberViews,
+		Messages: messages,
+	}, nil
+}
+
+// getMemberPresence shows online members of the room as in the room. Away members stay away wherever they are.
+func (service *RoomService) getMemberPresence(room *SocketRoom, userId int) Presence {
+	presence := PresenceOffline
+	if service.presence != nil {
+		presence = service.presence.getPresence(userId)
+	} else if service.lobby.IsConnected(userId) {
+		presence = PresenceOnline
+	}
+	if presence == PresenceOnline && room.HasUser(userId) {
+		return PresenceInRoom
+	}
+	return presence
+}
+
+// sendRoomSnapshot pushes the snapshot to the user who just joined. Failures are only logged
+// because the join itself already succeeded.
+func (service *RoomService) sendRoomSnapshot(ctx context.Context, room *SocketRoom, userId int) {
+	snapshot, err := service.GetRoomSnapshot(ctx, room)
+	if err != nil {
+		log.Println(fmt.Sprintf("unable to build snapshot of room %v: %v", room.Read().ID, err))
+		return
+	}
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := room.SendToUser(userId, NewSocketMessage(EventRoomSnapshot, string(body))); err != nil {
+		log.Println(fmt.Sprintf("unable to send snapshot of room %v to user %v: %v", room.Read().ID, userId, err))
+	}
+}
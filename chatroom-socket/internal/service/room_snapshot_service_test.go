@@ -0,0 +1,33 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"testing"
+)
+
+type fakePresenceReader map[int]Presence
+
+func (presences fakePresenceReader) getPresence(userId int) Presence {
+	if presence, ok := presences[userId]; ok {
+		return presence
+	}
+	return PresenceOffline
+}
+
+func TestGetMemberPresence(t *testing.T) {
+	service := newTestRoomService(newFakeChatRoomRepository())
+	room := addTestRoom(t, service, RoomTypePublic, testOwnerId)
+	const inRoomId, awayInRoomId, onlineId, awayId, offlineId = 1, 2, 3, 4, 5
+	for _, userId := range []int{inRoomId, awayInRoomId} {
+		if err := service.joinRoom(room.Read().ID, User{ID: userId}, []*SocketConnection{newTestConnection()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service.SetPresenceReader(fakePresenceReader{inRoomId: PresenceOnline, awayInRoomId: PresenceAway, onlineId: PresenceOnline, awayId: PresenceAway})
+
+	for userId, want := range map[int]Presence{inRoomId: PresenceInRoom, awayInRoomId: PresenceAway, onlineId: PresenceOnline, awayId: PresenceAway, offlineId: PresenceOffline} {
+		if presence := service.getMemberPresence(room, userId); presence != want {
+			t.Errorf("user %d: got %v, want %v", userId, presence, want)
+		}
+	}
+}
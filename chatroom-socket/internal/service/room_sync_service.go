@@ -0,0 +1,140 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+func isSameRoomRead(a *Room, b *Room) bool {
+	if a.Name != b.Name || a.RoomType != b.RoomType {
+		return false
+	}
+	if a.OwnerId == nil || b.OwnerId == nil {
+		if a.OwnerId != b.OwnerId {
+			return false
+		}
+	} else if *a.OwnerId != *b.OwnerId {
+		return false
+	}
+	if a.UpdatedAt == nil || b.UpdatedAt == nil {
+		return a.UpdatedAt == b.UpdatedAt
+	}
+	return a.UpdatedAt.Equal(*b.UpdatedAt)
+}
+
+// applyRoomRead adds, updates or evicts the cached room so that it matches the database.
+// A nil read means the room is deleted or does not exist anymore.
+func (service *RoomService) applyRoomRead(ctx context.Context, roomId uuid.UUID, read *Room) error {
+	room, err := service.GetRoom(roomId)
+	isCached := err == nil
+
+	switch {
+	case read == nil && isCached:
+		log.Println(fmt.Sprintf("Room %v was removed outside of the service", roomId))
+		return service.evictRoom(room)
+	case read == nil:
+		return nil
+	case !isCached:
+		log.Println(fmt.Sprintf("Room %v was added outside of the service", roomId))
+		service.addRoomToCache(*read)
+		return nil
+	}
+
+	previousRead := room.read.Swap(read)
+	if isSameRoomRead(previousRead, read) {
+		return nil
+	}
+	settings, err := service.chatRoomRepository.GetRoomSettings(ctx, roomId)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{
+		"room":     read,
+		"settings": settings,
+	})
+	if err != nil {
+		return err
+	}
+	room.broadcastMessage(NewSocketMessage(EventRoomSettingsUpdated, string(body)))
+	return nil
+}
+
+func (service *RoomService) SyncRoom(ctx context.Context, roomId uuid.UUID) error {
+	read, err := service.chatRoomRepository.GetRoomById(ctx, roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.applyRoomRead(ctx, roomId, nil)
+	}
+	if err != nil {
+		return err
+	}
+	return service.applyRoomRead(ctx, roomId, read)
+}
+
+// ReconcileRooms diffs the whole room cache against the database. It is the fallback
+// for notifications that were missed.
+func (service *RoomService) ReconcileRooms(ctx context.Context) error {
+	rooms, err := service.chatRoomRepository.GetAllRooms()
+	if err != nil {
+		return err
+	}
+	reads := make(map[uuid.UUID]*Room, len(rooms))
+	for index := range rooms {
+		reads[rooms[index].ID] = &rooms[index]
+	}
+
+	service.RoomServiceLock.Lock()
+	roomIds := make([]uuid.UUID, 0, len(service.AllRooms))
+	for roomId := range service.AllRooms {
+		roomIds = append(roomIds, roomId)
+	}
+	service.RoomServiceLock.Unlock()
+	for roomId := range reads {
+		if _, err := service.GetRoom(roomId); err != nil {
+			roomIds = append(roomIds, roomId)
+		}
+	}
+
+	for _, roomId := range roomIds {
+		if err := service.applyRoomRead(ctx, roomId, reads[roomId]); err != nil {
+			log.Println(fmt.Sprintf("unable to reconcile room %v: %v", roomId, err))
+		}
+	}
+	return nil
+}
+
+// WatchRoomChanges applies room change notifications as they arrive and reconciles
+// everything on every interval and whenever notifications may have been lost.
+func (service *RoomService) WatchRoomChanges(ctx context.Context, roomChanges <-chan uuid.UUID, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case roomId, ok := <-roomChanges:
+			if !ok {
+				return
+			}
+			var err error
+			if roomId == uuid.Nil {
+				err = service.ReconcileRooms(ctx)
+			} else {
+				err = service.SyncRoom(ctx, roomId)
+			}
+			if err != nil {
+				log.Println(fmt.Sprintf("unable to sync room change %v: %v", roomId, err))
+			}
+		case <-ticker.C:
+			if err := service.ReconcileRooms(ctx); err != nil {
+				log.Println(fmt.Sprintf("unable to reconcile rooms: %v", err))
+			}
+		}
+	}
+}
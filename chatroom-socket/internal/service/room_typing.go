@@ -0,0 +1,130 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	TypingTimeout  = 5 * time.Second // A typing state expires unless typing_started is sent again within this time.
+	TypingThrottle = 2 * time.Second // Refreshes within this time extend the state without another broadcast.
+)
+
+type typingState struct {
+	expireTimer   *time.Timer
+	expiresAt     time.Time
+	lastBroadcast time.Time
+}
+
+type TypingEvent struct {
+	RoomId   string `json:"room_id"`
+	UserId   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+}
+
+func (room *SocketRoom) StartTyping(user User) {
+	room.typingLock.Lock()
+	state, ok := room.typing[user.ID]
+	if ok {
+		state.expiresAt = time.Now().Add(TypingTimeout)
+		state.expireTimer.Reset(TypingTimeout)
+		if time.Since(state.lastBroadcast) < TypingThrottle {
+			room.typingLock.Unlock()
+			return
+		}
+		state.lastBroadcast = time.Now()
+	} else {
+		state = &typingState{expiresAt: time.Now().Add(TypingTimeout), lastBroadcast: time.Now()}
+		state.expireTimer = time.AfterFunc(TypingTimeout, func() { room.expireTyping(user, state) })
+		room.typing[user.ID] = state
+	}
+	room.typingLock.Unlock()
+	room.broadcastTyping(EventTypingStarted, user)
+}
+
+func (room *SocketRoom) StopTyping(user User) {
+	room.typingLock.Lock()
+	state, ok := room.typing[user.ID]
+	if !ok {
+		room.typingLock.Unlock()
+		return
+	}
+	room.unsafeStopTyping(user, state)
+}
+
+// expireTyping is run by the timer of the state. The timer may have fired while the state was refreshed
+// or replaced, in which case the newer state is kept.
+func (room *SocketRoom) expireTyping(user User, expiredState *typingState) {
+	room.typingLock.Lock()
+	state, ok := room.typing[user.ID]
+	if !ok || state != expiredState || time.Now().Before(state.expiresAt) {
+		room.typingLock.Unlock()
+		return
+	}
+	room.unsafeStopTyping(user, state)
+}
+
+// unsafeStopTyping removes the state and releases the typing lock the caller holds before broadcasting.
+func (room *SocketRoom) unsafeStopTyping(user User, state *typingState) {
+	state.expireTimer.Stop()
+	delete(room.typing, user.ID)
+	room.typingLock.Unlock()
+	room.broadcastTyping(EventTypingStopped, user)
+}
+
+// broadcastTyping fans the event out to the other users of the room. Typing events are neither
+// persisted nor numbered, so they are never replayed.
+func (room *SocketRoom) broadcastTyping(event EventType, user User) {
+	body, err := json.Marshal(&TypingEvent{RoomId: room.Read().ID.String(), UserId: user.ID, UserName: user.UserName})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	encoded, err := EncodeSocketMessage(NewSocketMessage(event, string(body)))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, socket := range room.connections(user.ID) {
+		if err := socket.SendEncoded(encoded); err != nil {
+			continue
+		}
+	}
+}
+
+func (service *RoomService) RegisterSocketEvents(registry *SocketEventRegistry) error {
+	typingStarted := NewSocketEventHandler(EventTypingStarted, service.handleEventTypingStarted)
+	typingStarted.RateLimit = RateLimit{Count: 30, Window: 10 * time.Second}
+	typingStopped := NewSocketEventHandler(EventTypingStopped, service.handleEventTypingStopped)
+	typingStopped.RateLimit = RateLimit{Count: 30, Window: 10 * time.Second}
+	return registry.Register(typingStarted, typingStopped)
+}
+
+func (service *RoomService) getUserRoom(userId int) (*SocketRoom, error) {
+	roomId, err := service.GetUserLocation(userId)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetRoom(roomId)
+}
+
+func (service *RoomService) handleEventTypingStarted(ctx context.Context, user User, _ *struct{}) error {
+	room, err := service.getUserRoom(user.ID)
+	if err != nil {
+		return err
+	}
+	room.StartTyping(user)
+	return nil
+}
+
+func (service *RoomService) handleEventTypingStopped(ctx context.Context, user User, _ *struct{}) error {
+	room, err := service.getUserRoom(user.ID)
+	if err != nil {
+		return err
+	}
+	room.StopTyping(user)
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSessionGracePeriod = 30 * time.Second
+	sessionTokenBytes         = 32
+)
+
+// SocketSession outlives its connection for a grace period, so that a client reconnecting
+// with the session token gets back into its room instead of leaving and joining again.
+type SocketSession struct {
+	Token        string
+	UserId       int
+	ConnectionId uuid.UUID
+	suspended    bool
+	expireTimer  *time.Timer
+}
+
+type SessionService struct {
+	RoomService *RoomService
+	GracePeriod time.Duration
+	sessions    map[string]*SocketSession
+	sessionLock *sync.Mutex
+}
+
+func NewSessionService(roomService *RoomService, gracePeriod time.Duration) *SessionService {
+	return &SessionService{
+		RoomService: roomService,
+		GracePeriod: gracePeriod,
+		sessions:    make(map[string]*SocketSession),
+		sessionLock: new(sync.Mutex),
+	}
+}
+
+func (service *SessionService) StartSession(user User, socket *SocketConnection) (*SocketSession, error) {
+	token, err := newRandomToken(sessionTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	session := &SocketSession{
+		Token:        token,
+		UserId:       user.ID,
+		ConnectionId: socket.Id,
+	}
+	service.sessionLock.Lock()
+	defer service.sessionLock.Unlock()
+	service.sessions[token] = session
+	return session, nil
+}
+
+// ResumeSession hands the session over to the new connection and replays the room broadcasts
+// the client missed after lastSeq. It returns the id of the connection that was replaced.
+func (service *SessionService) ResumeSession(ctx context.Context, user User, token string, lastSeq uint64, socket *SocketConnection) (*SocketSession, uuid.UUID, error) {
+	service.sessionLock.Lock()
+	session, ok := service.sessions[token]
+	if !ok || session.UserId != user.ID {
+		service.sessionLock.Unlock()
+		return nil, uuid.Nil, ErrSessionNotFound
+	}
+	if session.expireTimer != nil {
+		session.expireTimer.Stop()
+		session.expireTimer = nil
+	}
+	session.suspended = false
+	oldConnectionId := session.ConnectionId
+	session.ConnectionId = socket.Id
+	service.sessionLock.Unlock()
+
+	// The new connection only joins the room after session_resumed, so that no broadcast precedes it.
+	body, err := json.Marshal(map[string]any{"session_token": session.Token, "connection_id": socket.Id})
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if err := socket.Send(NewSocketMessage(EventSessionResumed, string(body))); err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	roomService := service.RoomService
+	roomService.RoomServiceLock.Lock()
+	var room *SocketRoom
+	complete := true
+	if roomId, ok := roomService.UserLocation[user.ID]; ok {
+		if cachedRoom, err := roomService.unsafeGetRoom(roomId); err == nil {
+			var resumed bool
+			if resumed, complete = cachedRoom.ResumeConnection(user.ID, oldConnectionId, socket, lastSeq); resumed {
+				room = cachedRoom
+			}
+		}
+	}
+	roomService.RoomServiceLock.Unlock()
+	if room != nil && !complete {
+		// The missed broadcasts are no longer kept, a fresh snapshot replaces them.
+		roomService.sendRoomSnapshot(ctx, room, user.ID)
+	}
+	log.Println(fmt.Sprintf("user %v resumed session on connection %v", user.UserName, socket.Id))
+	return session, oldConnectionId, nil
+}
+
+// EndConnection is called once a connection is gone. The user stays in their room for the grace
+// period in case the session is resumed.
+func (service *SessionService) EndConnection(user User, token string, connectionId uuid.UUID) {
+	service.sessionLock.Lock()
+	session, ok := service.sessions[token]
+	if ok && session.ConnectionId != connectionId {
+		// Another connection resumed the session and took over the room.
+		service.sessionLock.Unlock()
+		return
+	}
+	if !ok || service.GracePeriod <= 0 {
+		delete(service.sessions, token)
+		service.sessionLock.Unlock()
+		service.leaveRoom(user, connectionId)
+		return
+	}
+	session.suspended = true
+	session.expireTimer = time.AfterFunc(service.GracePeriod, func() {
+		service.expireSession(user, token, connectionId)
+	})
+	service.sessionLock.Unlock()
+}
+
+func (service *SessionService) expireSession(user User, token string, connectionId uuid.UUID) {
+	service.sessionLock.Lock()
+	session, ok := service.sessions[token]
+	if !ok || !session.suspended || session.ConnectionId != connectionId {
+		service.sessionLock.Unlock()
+		return
+	}
+	delete(service.sessions, token)
+	service.sessionLock.Unlock()
+	log.Println(fmt.Sprintf("session of user %v expired", user.UserName))
+	service.leaveRoom(user, connectionId)
+}
+
+func (service *SessionService) leaveRoom(user User, connectionId uuid.UUID) {
+	if err := service.RoomService.ConnectionLeaveRoom(user, connectionId); err != nil {
+		return
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultSendQueueSize = 256
+	DefaultPingInterval  = 25 * time.Second
+	DefaultPongTimeout   = 60 * time.Second
+	DefaultWriteTimeout  = 10 * time.Second
+	closeMessageTimeout  = time.Second
+)
+
+type SocketConfig struct {
+	SendQueueSize int
+	PingInterval  time.Duration
+	PongTimeout   time.Duration // A connection is dead when nothing, not even a pong, was read for this long.
+	WriteTimeout  time.Duration
+}
+
+func DefaultSocketConfig() SocketConfig {
+	return SocketConfig{
+		SendQueueSize: DefaultSendQueueSize,
+		PingInterval:  DefaultPingInterval,
+		PongTimeout:   DefaultPongTimeout,
+		WriteTimeout:  DefaultWriteTimeout,
+	}
+}
+
+var (
+	ErrConnectionClosed = errors.New("socket connection is closed")
+	ErrSendQueueFull    = errors.New("socket send queue is full")
+)
+
+type outboundFrame struct {
+	messageType int
+	data        []byte
+}
+
+// SocketConnection owns the only goroutine allowed to write to its websocket.
+// Everything sent to the client is queued on a bounded channel, so a slow client
+// only fills its own queue and gets disconnected instead of blocking the sender.
+type SocketConnection struct {
+	Id        uuid.UUID
+	Version   ProtocolVersion
+	Conn      *websocket.Conn
+	config    SocketConfig
+	send      chan outboundFrame
+	done      chan struct{}
+	closeOnce *sync.Once
+	lastSeen  *atomic.Int64
+}
+
+func NewSocketConnection(conn *websocket.Conn, config SocketConfig) *SocketConnection {
+	connection := &SocketConnection{
+		Id:        uuid.New(),
+		Version:   ProtocolVersionOf(conn.Subprotocol()),
+		Conn:      conn,
+		config:    config,
+		send:      make(chan outboundFrame, config.SendQueueSize),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+		lastSeen:  new(atomic.Int64),
+	}
+	connection.Touch()
+	conn.SetPongHandler(func(string) error {
+		connection.Touch()
+		return nil
+	})
+	go connection.writePump()
+	return connection
+}
+
+// Touch records that the client is alive and pushes the read deadline back.
+// It must be called from the goroutine reading the connection.
+func (connection *SocketConnection) Touch() {
+	now := time.Now()
+	connection.lastSeen.Store(now.UnixNano())
+	if err := connection.Conn.SetReadDeadline(now.Add(connection.config.PongTimeout)); err != nil {
+		log.Println(err)
+	}
+}
+
+func (connection *SocketConnection) IsStale() bool {
+	lastSeen := time.Unix(0, connection.lastSeen.Load())
+	return time.Since(lastSeen) > connection.config.PongTimeout
+}
+
+func (connection *SocketConnection) enqueue(frame outboundFrame) error {
+	select {
+	case <-connection.done:
+		return ErrConnectionClosed
+	default:
+	}
+	select {
+	case connection.send <- frame:
+		return nil
+	default:
+		log.Println("Closing slow socket connection:", connection.Conn.RemoteAddr())
+		connection.Close()
+		return ErrSendQueueFull
+	}
+}
+
+// Send queues a message in the protocol version of the connection. It never blocks.
+func (connection *SocketConnection) Send(message *SocketMessage) error {
+	encoded, err := EncodeSocketMessage(message)
+	if err != nil {
+		return err
+	}
+	return connection.SendEncoded(encoded)
+}
+
+// SendEncoded queues an already encoded message, so broadcasts only encode once.
+func (connection *SocketConnection) SendEncoded(message *EncodedSocketMessage) error {
+	return connection.sendData(message.forVersion(connection.Version))
+}
+
+func (connection *SocketConnection) sendData(data []byte) error {
+	return connection.enqueue(outboundFrame{messageType: websocket.TextMessage, data: data})
+}
+
+// SendText sends a plain text frame to v1 clients and an event_notification to v2 clients.
+func (connection *SocketConnection) SendText(text string) error {
+	if connection.Version == ProtocolV2 {
+		return connection.Send(NewSocketMessage(EventNotification, text))
+	}
+	return connection.sendData([]byte(text))
+}
+
+// SendAck confirms a v2 request. V1 clients never get acks.
+func (connection *SocketConnection) SendAck(requestId string, event EventType) error {
+	if connection.Version != ProtocolV2 {
+		return nil
+	}
+	data, err := encodeEnvelope(requestId, EventAck, map[string]any{"event": event})
+	if err != nil {
+		return err
+	}
+	return connection.sendData(data)
+}
+
+// SendError reports a failed request as an error event with a code, or as plain text to v1 clients.
+func (connection *SocketConnection) SendError(requestId string, err error) error {
+	if connection.Version != ProtocolV2 {
+		return connection.sendData([]byte(err.Error()))
+	}
+	code := GetErrorCode(err)
+	if len(code) == 0 {
+		code = CodeRequestFailed
+	}
+	data, encodeErr := encodeEnvelope(requestId, EventError, NewServiceError(code, err.Error()))
+	if encodeErr != nil {
+		return encodeErr
+	}
+	return connection.sendData(data)
+}
+
+// Close stops the writer once the queued messages are flushed. It is safe to call more than once.
+func (connection *SocketConnection) Close() {
+	connection.closeOnce.Do(func() {
+		close(connection.done)
+	})
+}
+
+func (connection *SocketConnection) Done() <-chan struct{} {
+	return connection.done
+}
+
+func (connection *SocketConnection) write(frame outboundFrame) error {
+	if err := connection.Conn.SetWriteDeadline(time.Now().Add(connection.config.WriteTimeout)); err != nil {
+		return err
+	}
+	return connection.Conn.WriteMessage(frame.messageType, frame.data)
+}
+
+func (connection *SocketConnection) writePump() {
+	pingTicker := time.NewTicker(connection.config.PingInterval)
+	defer func() {
+		pingTicker.Stop()
+		if err := connection.Conn.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	for {
+		select {
+		case <-pingTicker.C:
+			deadline := time.Now().Add(connection.config.WriteTimeout)
+			if err := connection.Conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				log.Println("socket ping error:", err)
+				connection.Close()
+				return
+			}
+		case frame := <-connection.send:
+			if err := connection.write(frame); err != nil {
+				log.Println("socket write error:", err)
+				connection.Close()
+				return
+			}
+		case <-connection.done:
+			connection.flush()
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			if err := connection.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(closeMessageTimeout)); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+}
+
+// flush writes whatever is still queued, such as a goodbye message sent right before Close.
+func (connection *SocketConnection) flush() {
+	for {
+		select {
+		case frame := <-connection.send:
+			if err := connection.write(frame); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
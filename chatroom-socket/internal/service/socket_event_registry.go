@@ -0,0 +1,131 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Count events per Window. The zero value does not limit anything.
+type RateLimit struct {
+	Count  int
+	Window time.Duration
+}
+
+// SocketEventHandler handles one event type sent by clients. RequiredRole, when set, is checked
+// against the role of the user in the room they are in.
+type SocketEventHandler struct {
+	Event        EventType
+	RequiredRole RoomRole
+	RateLimit    RateLimit
+	handle       func(ctx context.Context, user User, payload json.RawMessage) error
+}
+
+// NewSocketEventHandler creates a handler whose payload is decoded into T before handle is called.
+func NewSocketEventHandler[T any](event EventType, handle func(ctx context.Context, user User, payload *T) error) *SocketEventHandler {
+	return &SocketEventHandler{
+		Event: event,
+		handle: func(ctx context.Context, user User, payload json.RawMessage) error {
+			var schema T
+			if err := decodeSocketContent(payload, &schema); err != nil {
+				return err
+			}
+			return handle(ctx, user, &schema)
+		},
+	}
+}
+
+// decodeSocketContent converts the payload of a socket request into a schema struct. An empty
+// payload leaves the schema at its zero value.
+func decodeSocketContent(payload json.RawMessage, schema any) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(payload, schema); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return nil
+}
+
+type SocketEventRegistry struct {
+	RoomService  *RoomService
+	handlers     map[EventType]*SocketEventHandler
+	rateLimiter  *RateLimiter
+	registryLock *sync.RWMutex
+}
+
+func NewSocketEventRegistry(roomService *RoomService) *SocketEventRegistry {
+	return &SocketEventRegistry{
+		RoomService:  roomService,
+		handlers:     make(map[EventType]*SocketEventHandler),
+		rateLimiter:  NewRateLimiter(),
+		registryLock: new(sync.RWMutex),
+	}
+}
+
+func (registry *SocketEventRegistry) Register(handlers ...*SocketEventHandler) error {
+	registry.registryLock.Lock()
+	defer registry.registryLock.Unlock()
+	for _, handler := range handlers {
+		if _, exists := registry.handlers[handler.Event]; exists {
+			return fmt.Errorf("socket event %v is already registered", handler.Event)
+		}
+		registry.handlers[handler.Event] = handler
+	}
+	return nil
+}
+
+func (registry *SocketEventRegistry) GetEvents() []string {
+	registry.registryLock.RLock()
+	defer registry.registryLock.RUnlock()
+	events := make([]string, 0, len(registry.handlers))
+	for event := range registry.handlers {
+		events = append(events, string(event))
+	}
+	slices.Sort(events)
+	return events
+}
+
+// Dispatch checks the role and rate limit of the handler registered for the event and runs it.
+func (registry *SocketEventRegistry) Dispatch(ctx context.Context, user User, request *SocketRequest) error {
+	registry.registryLock.RLock()
+	handler, ok := registry.handlers[request.Event]
+	registry.registryLock.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %v, please enter one of the following: %s", ErrUnknownEvent, request.Event, strings.Join(registry.GetEvents(), ","))
+	}
+	if !registry.rateLimiter.Allow(user.ID, string(handler.Event), handler.RateLimit) {
+		return fmt.Errorf("%w: at most %d %v per %v", ErrRateLimited, handler.RateLimit.Count, handler.Event, handler.RateLimit.Window)
+	}
+	if err := registry.authorize(ctx, user, handler); err != nil {
+		return err
+	}
+	return handler.handle(ctx, user, request.Payload)
+}
+
+func (registry *SocketEventRegistry) authorize(ctx context.Context, user User, handler *SocketEventHandler) error {
+	if len(handler.RequiredRole) == 0 {
+		return nil
+	}
+	roomId, err := registry.RoomService.GetUserLocation(user.ID)
+	if err != nil {
+		return err
+	}
+	room, err := registry.RoomService.GetRoom(roomId)
+	if err != nil {
+		return err
+	}
+	role, err := registry.RoomService.GetRoomRole(ctx, room, user.ID)
+	if err != nil {
+		return err
+	}
+	if roomRoleRanks[role] < roomRoleRanks[handler.RequiredRole] {
+		return fmt.Errorf("%w: %v requires role %v", ErrInsufficientRoomRole, handler.Event, handler.RequiredRole)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testEvent EventType = "event_test"
+
+type testEventSchema struct {
+	Text string `json:"text"`
+}
+
+func newTestRegistry(t *testing.T, handler *SocketEventHandler) (*SocketEventRegistry, *fakeChatRoomRepository) {
+	t.Helper()
+	repository := newFakeChatRoomRepository()
+	registry := NewSocketEventRegistry(newTestRoomService(repository))
+	if err := registry.Register(handler); err != nil {
+		t.Fatal(err)
+	}
+	return registry, repository
+}
+
+func newTestRequest(payload string) *SocketRequest {
+	return &SocketRequest{Event: testEvent, Payload: json.RawMessage(payload)}
+}
+
+func TestSocketEventRegistryDispatch(t *testing.T) {
+	var received string
+	handler := NewSocketEventHandler(testEvent, func(ctx context.Context, user User, schema *testEventSchema) error {
+		received = schema.Text
+		return nil
+	})
+	registry, _ := newTestRegistry(t, handler)
+	ctx := context.Background()
+
+	if err := registry.Register(handler); err == nil {
+		t.Error("registered the same event twice")
+	}
+	if err := registry.Dispatch(ctx, User{ID: 1}, newTestRequest(`{"text":"hello"}`)); err != nil || received != "hello" {
+		t.Errorf("got %q, %v", received, err)
+	}
+	if err := registry.Dispatch(ctx, User{ID: 1}, newTestRequest(`{"text":`)); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("invalid payload: got %v, want %v", err, ErrInvalidMessage)
+	}
+	unknown := &SocketRequest{Event: "event_unknown"}
+	if err := registry.Dispatch(ctx, User{ID: 1}, unknown); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("unknown event: got %v, want %v", err, ErrUnknownEvent)
+	}
+}
+
+func TestSocketEventRegistryRateLimit(t *testing.T) {
+	var handled atomic.Int32
+	handler := NewSocketEventHandler(testEvent, func(ctx context.Context, user User, schema *testEventSchema) error {
+		handled.Add(1)
+		return nil
+	})
+	handler.RateLimit = RateLimit{Count: 5, Window: time.Minute}
+	registry, _ := newTestRegistry(t, handler)
+
+	var limited atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := registry.Dispatch(context.Background(), User{ID: 1}, newTestRequest(""))
+			if errors.Is(err, ErrRateLimited) {
+				limited.Add(1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if handled.Load() != 5 || limited.Load() != 15 {
+		t.Errorf("got %d handled and %d limited, want 5 and 15", handled.Load(), limited.Load())
+	}
+	if err := registry.Dispatch(context.Background(), User{ID: 2}, newTestRequest("")); err != nil {
+		t.Errorf("limit leaked to another user: %v", err)
+	}
+}
+
+func TestSocketEventRegistryRequiredRole(t *testing.T) {
+	handler := NewSocketEventHandler(testEvent, func(ctx context.Context, user User, schema *testEventSchema) error {
+		return nil
+	})
+	handler.RequiredRole = RoomRoleModerator
+	registry, repository := newTestRegistry(t, handler)
+	roomService := registry.RoomService
+	room := addTestRoom(t, roomService, RoomTypePublic, testOwnerId)
+	ctx := context.Background()
+
+	const memberId, moderatorId, strangerId = 2, 3, 4
+	for _, userId := range []int{testOwnerId, memberId, moderatorId, strangerId} {
+		roomService.UserLocation[userId] = room.Read().ID
+	}
+	if err := repository.AddRoomMember(ctx, room.Read().ID, memberId, nil, RoomJoinDirect); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.AddRoomMember(ctx, room.Read().ID, moderatorId, nil, RoomJoinDirect); err != nil {
+		t.Fatal(err)
+	}
+	repository.members[roomMemberKey{RoomId: room.Read().ID, UserId: moderatorId}].Role = RoomRoleModerator
+
+	tests := []struct {
+		userId int
+		want   error
+	}{
+		{testOwnerId, nil},
+		{moderatorId, nil},
+		{memberId, ErrInsufficientRoomRole},
+		{strangerId, ErrInsufficientRoomRole},
+	}
+	for _, test := range tests {
+		err := registry.Dispatch(ctx, User{ID: test.userId}, newTestRequest(""))
+		if !errors.Is(err, test.want) {
+			t.Errorf("user %d: got %v, want %v", test.userId, err, test.want)
+		}
+	}
+	if err := registry.Dispatch(ctx, User{ID: 5}, newTestRequest("")); err == nil {
+		t.Error("user outside any room passed the role check")
+	}
+}
+
+func TestSocketEventRegistryAcceptsAssistantMessage(t *testing.T) {
+	registry := NewSocketEventRegistry(newTestRoomService(newFakeChatRoomRepository()))
+	if err := (&AssistantService{}).RegisterSocketEvents(registry); err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{`"hello"`, `{"content":"hello"}`} {
+		request := &SocketRequest{Event: EventSendAssistantChatMessage, Payload: json.RawMessage(payload)}
+		if err := registry.Dispatch(context.Background(), User{ID: 1}, request); err != nil {
+			t.Errorf("payload %v: %v", payload, err)
+		}
+	}
+}
@@ -3,36 +3,112 @@ package service
 import (
 	. "chatroom-socket/internal/repository"
 	"context"
-	"errors"
-	"strings"
+	"encoding/json"
+	"fmt"
+	"time"
 )
 
-func (service *ChatMessageService) ReceiveSocketMessage(ctx context.Context, user User, event EventType, message any) error {
-	validEventTypes := service.GetValidEventTypes()
-	if !service.IsValidEventType(event) {
-		return errors.New("invalid event, please enter one of the following: " + strings.Join(validEventTypes, ","))
-	}
-	switch event {
-	case EventSendRegularMessage:
-		messageMap, ok := message.(map[string]any)
-		if !ok {
-			return errors.New("invalid message format")
-		}
-		content, ok := messageMap["content"].(string)
-		if !ok {
-			return errors.New("invalid message format, content key not found in message")
-		}
-		err := service.handleEventSendMessage(ctx, user, content)
-		if err != nil {
-			return err
-		}
+// RegularMessageSchema also accepts the content sent directly as a string.
+type RegularMessageSchema struct {
+	Content  string  `json:"content"`
+	ParentId *string `json:"parent_id"`
+}
+
+func (schema *RegularMessageSchema) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &schema.Content); err == nil {
+		return nil
+	}
+	var object struct {
+		Content  string  `json:"content"`
+		ParentId *string `json:"parent_id"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	schema.Content = object.Content
+	schema.ParentId = object.ParentId
+	return nil
+}
+
+type ModerateUserSchema struct {
+	Action ModerationAction `json:"action"`
+	ModerationSchema
+}
+
+type MarkReadSchema struct {
+	MessageId string `json:"message_id"`
+}
+
+type DirectMessageSchema struct {
+	RecipientId int    `json:"recipient_id"`
+	Content     string `json:"content"`
+}
+
+func (service *ChatMessageService) RegisterSocketEvents(registry *SocketEventRegistry) error {
+	sendMessage := NewSocketEventHandler(EventSendRegularMessage, service.handleEventSendMessage)
+	sendMessage.RateLimit = RateLimit{Count: 20, Window: 10 * time.Second}
+
+	moderateUser := NewSocketEventHandler(EventModerateUser, service.handleEventModerateUser)
+	moderateUser.RequiredRole = RoomRoleModerator
+
+	markRead := NewSocketEventHandler(EventMarkRead, service.handleEventMarkRead)
+	markRead.RateLimit = RateLimit{Count: 30, Window: 10 * time.Second}
+
+	editMessage := NewSocketEventHandler(EventEditMessage, service.handleEventEditMessage)
+	editMessage.RateLimit = RateLimit{Count: 10, Window: 10 * time.Second}
+
+	deleteMessage := NewSocketEventHandler(EventDeleteMessage, service.handleEventDeleteMessage)
+	deleteMessage.RateLimit = RateLimit{Count: 10, Window: 10 * time.Second}
+
+	// Reactions are rate limited by the service, which covers REST as well.
+	addReaction := NewSocketEventHandler(EventAddReaction, service.handleEventAddReaction)
+	removeReaction := NewSocketEventHandler(EventRemoveReaction, service.handleEventRemoveReaction)
+
+	pinMessage := NewSocketEventHandler(EventPinMessage, service.handleEventPinMessage)
+	pinMessage.RateLimit = RateLimit{Count: 10, Window: 10 * time.Second}
+
+	unpinMessage := NewSocketEventHandler(EventUnpinMessage, service.handleEventUnpinMessage)
+	unpinMessage.RateLimit = RateLimit{Count: 10, Window: 10 * time.Second}
+
+	return registry.Register(sendMessage, moderateUser, markRead, editMessage, deleteMessage, addReaction, removeReaction, pinMessage, unpinMessage)
+}
+
+func (service *DirectMessageService) RegisterSocketEvents(registry *SocketEventRegistry) error {
+	sendDirectMessage := NewSocketEventHandler(EventSendDirectMessage, service.handleEventSendDirectMessage)
+	sendDirectMessage.RateLimit = RateLimit{Count: 20, Window: 10 * time.Second}
+	return registry.Register(sendDirectMessage)
+}
+
+func (service *ChatMessageService) handleEventModerateUser(ctx context.Context, user User, schema *ModerateUserSchema) error {
+	roomId, err := service.RoomService.GetUserLocation(user.ID)
+	if err != nil {
+		return err
 	}
+	return service.RoomService.ModerateUser(ctx, user, roomId, schema.Action, &schema.ModerationSchema)
+}
 
+func (service *ChatMessageService) handleEventSendMessage(ctx context.Context, user User, schema *RegularMessageSchema) error {
+	if len(schema.Content) == 0 {
+		return fmt.Errorf("%w: content is required", ErrInvalidMessage)
+	}
+	if _, err := service.SendMessageToRoomId(ctx, user.ID, schema.Content, schema.ParentId); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (service *ChatMessageService) handleEventMarkRead(ctx context.Context, user User, schema *MarkReadSchema) error {
+	if len(schema.MessageId) == 0 {
+		return fmt.Errorf("%w: message_id is required", ErrInvalidMessage)
+	}
+	if _, err := service.MarkRead(ctx, user, schema.MessageId); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (service *ChatMessageService) handleEventSendMessage(ctx context.Context, user User, content string) error {
-	if _, err := service.SendMessageToRoomId(ctx, user.ID, content); err != nil {
+func (service *DirectMessageService) handleEventSendDirectMessage(ctx context.Context, user User, schema *DirectMessageSchema) error {
+	if _, err := service.SendDirectMessage(ctx, user, schema.RecipientId, schema.Content); err != nil {
 		return err
 	}
 	return nil
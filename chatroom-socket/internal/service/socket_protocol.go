@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type ProtocolVersion int
+
+const (
+	ProtocolV1 ProtocolVersion = 1 // {event, content} frames, errors as plain text.
+	ProtocolV2 ProtocolVersion = 2 // {v, id, event, payload} envelopes with acks and typed errors.
+)
+
+// Clients pick the protocol version with the websocket subprotocol. Connections without one speak v1.
+const (
+	SubprotocolV1 = "chatroom.v1"
+	SubprotocolV2 = "chatroom.v2"
+)
+
+const (
+	EventAck   EventType = "ack"
+	EventError EventType = "error"
+)
+
+func SupportedSubprotocols() []string {
+	return []string{SubprotocolV2, SubprotocolV1}
+}
+
+func ProtocolVersionOf(subprotocol string) ProtocolVersion {
+	if subprotocol == SubprotocolV2 {
+		return ProtocolV2
+	}
+	return ProtocolV1
+}
+
+type SocketEnvelope struct {
+	V       ProtocolVersion `json:"v"`
+	Id      string          `json:"id,omitempty"`
+	Event   EventType       `json:"event"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Seq     uint64          `json:"seq,omitempty"`
+}
+
+// SocketRequest is a message received from a client, whatever protocol version it speaks.
+type SocketRequest struct {
+	Id      string
+	Event   EventType
+	Payload json.RawMessage
+}
+
+func DecodeSocketRequest(version ProtocolVersion, data []byte) (*SocketRequest, error) {
+	var request SocketRequest
+	switch version {
+	case ProtocolV2:
+		var envelope SocketEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+		if envelope.V != ProtocolV2 {
+			return nil, fmt.Errorf("%w: unsupported protocol version %d", ErrInvalidMessage, envelope.V)
+		}
+		request = SocketRequest{Id: envelope.Id, Event: envelope.Event, Payload: envelope.Payload}
+	default:
+		var message struct {
+			Event   EventType       `json:"event"`
+			Content json.RawMessage `json:"content"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+		request = SocketRequest{Event: message.Event, Payload: unwrapJSONString(message.Content)}
+	}
+	if len(request.Event) == 0 {
+		return nil, fmt.Errorf("%w: event key not found in socket message", ErrInvalidMessage)
+	}
+	return &request, nil
+}
+
+// unwrapJSONString returns the JSON encoded inside a string, as v1 clients may send their content
+// either as an object or as a JSON string. Other strings are returned unchanged.
+func unwrapJSONString(content json.RawMessage) json.RawMessage {
+	var text string
+	if err := json.Unmarshal(content, &text); err != nil {
+		return content
+	}
+	if json.Valid([]byte(text)) {
+		return json.RawMessage(text)
+	}
+	return content
+}
+
+// contentPayload turns the string content of a SocketMessage into a v2 payload. Content that
+// already holds JSON is sent as is, anything else as a JSON string.
+func contentPayload(content string) (json.RawMessage, error) {
+	if json.Valid([]byte(content)) {
+		return json.RawMessage(content), nil
+	}
+	return json.Marshal(content)
+}
+
+// EncodedSocketMessage holds a message in every protocol version, so broadcasts encode it only once.
+type EncodedSocketMessage struct {
+	v1 []byte
+	v2 []byte
+}
+
+func EncodeSocketMessage(message *SocketMessage) (*EncodedSocketMessage, error) {
+	v1, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := contentPayload(message.Content)
+	if err != nil {
+		return nil, err
+	}
+	v2, err := json.Marshal(&SocketEnvelope{
+		V:       ProtocolV2,
+		Event:   message.Event,
+		Payload: payload,
+		Seq:     message.Seq,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EncodedSocketMessage{v1: v1, v2: v2}, nil
+}
+
+func (message *EncodedSocketMessage) forVersion(version ProtocolVersion) []byte {
+	if version == ProtocolV2 {
+		return message.v2
+	}
+	return message.v1
+}
+
+func encodeEnvelope(requestId string, event EventType, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&SocketEnvelope{
+		V:       ProtocolV2,
+		Id:      requestId,
+		Event:   event,
+		Payload: body,
+	})
+}
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"log"
 	"sync"
+	"time"
 )
 
 type EventType string
@@ -18,11 +21,44 @@ const (
 	EventUserLeftRoom             EventType = "event_user_left_room"
 	EventNotification             EventType = "event_notification"
 	EventGreeting                 EventType = "event_greeting"
+	EventRoomInvitation           EventType = "event_room_invitation"
+	EventModerateUser             EventType = "event_moderate_user"
+	EventRoomModeration           EventType = "event_room_moderation"
+	EventRoomSettingsUpdated      EventType = "room_settings_updated"
+	EventRoomOwnershipChanged     EventType = "room_ownership_changed"
+	EventRoomRemoved              EventType = "room_removed"
+	EventSendDirectMessage        EventType = "event_send_direct_message"
+	EventDirectMessage            EventType = "direct_message"
+	EventRoomSnapshot             EventType = "room_snapshot"
+	EventConnectionEstablished    EventType = "connection_established"
+	EventSessionResumed           EventType = "session_resumed"
+	EventMessageCommitted         EventType = "message_committed"
+	EventMarkRead                 EventType = "event_mark_read"
+	EventReadReceipt              EventType = "read_receipt"
+	EventTypingStarted            EventType = "typing_started"
+	EventTypingStopped            EventType = "typing_stopped"
+	EventSetStatus                EventType = "event_set_status"
+	EventPresenceChanged          EventType = "presence_changed"
+	EventEditMessage              EventType = "event_edit_message"
+	EventDeleteMessage            EventType = "event_delete_message"
+	EventMessageEdited            EventType = "message_edited"
+	EventMessageDeleted           EventType = "message_deleted"
+	EventAddReaction              EventType = "event_add_reaction"
+	EventRemoveReaction           EventType = "event_remove_reaction"
+	EventReactionAdded            EventType = "reaction_added"
+	EventReactionRemoved          EventType = "reaction_removed"
+	EventThreadReply              EventType = "thread_reply"
+	EventMention                  EventType = "mention"
+	EventPinMessage               EventType = "event_pin_message"
+	EventUnpinMessage             EventType = "event_unpin_message"
+	EventMessagePinned            EventType = "message_pinned"
+	EventMessageUnpinned          EventType = "message_unpinned"
 )
 
 type SocketMessage struct {
 	Event   EventType `json:"event"`
 	Content string    `json:"content"`
+	Seq     uint64    `json:"seq,omitempty"` // Position in the room history, only set on room broadcasts.
 }
 
 func NewSocketMessage(event EventType, content string) *SocketMessage {
@@ -32,56 +68,152 @@ func NewSocketMessage(event EventType, content string) *SocketMessage {
 	}
 }
 
+// SocketService keeps every open connection of every user. A user may be connected from several devices.
 type SocketService struct {
-	UserSockets map[int]*websocket.Conn
+	UserSockets map[int]map[uuid.UUID]*SocketConnection
 	ServiceLock *sync.Mutex
+	Config      SocketConfig
 }
 
-func NewSocketService() *SocketService {
+func NewSocketService(config SocketConfig) *SocketService {
 	return &SocketService{
-		UserSockets: make(map[int]*websocket.Conn),
+		UserSockets: make(map[int]map[uuid.UUID]*SocketConnection),
 		ServiceLock: new(sync.Mutex),
+		Config:      config,
 	}
 }
 
-func (service *SocketService) AddSocket(socket *websocket.Conn, userId int) {
+// NewConnection wraps an upgraded websocket so that all writes go through its own writer goroutine.
+func (service *SocketService) NewConnection(conn *websocket.Conn) *SocketConnection {
+	return NewSocketConnection(conn, service.Config)
+}
+
+// ReapDeadConnections closes the connections that stopped answering pings. Closing makes the
+// pending read fail, so the socket handler cleans up the user like any other disconnect.
+func (service *SocketService) ReapDeadConnections() {
 	service.ServiceLock.Lock()
 	defer service.ServiceLock.Unlock()
+	for userId, sockets := range service.UserSockets {
+		for _, socket := range sockets {
+			if socket.IsStale() {
+				log.Printf("Reaping dead socket %v of user %d", socket.Id, userId)
+				socket.Close()
+			}
+		}
+	}
+}
 
-	service.UserSockets[userId] = socket
+func (service *SocketService) WatchDeadConnections(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.ReapDeadConnections()
+		}
+	}
+}
+
+func (service *SocketService) AddSocket(socket *SocketConnection, userId int) {
+	service.ServiceLock.Lock()
+	defer service.ServiceLock.Unlock()
 
+	sockets, ok := service.UserSockets[userId]
+	if !ok {
+		sockets = make(map[uuid.UUID]*SocketConnection)
+		service.UserSockets[userId] = sockets
+	}
+	sockets[socket.Id] = socket
 }
 
 func (service *SocketService) SendNotification(message *SocketMessage) {
-	for userId, socket := range service.UserSockets {
-		err := socket.WriteJSON(message)
-		if err != nil {
-			log.Printf("socket write json error for user %d: %v", userId, err)
-			continue
+	encoded, err := EncodeSocketMessage(message)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	service.ServiceLock.Lock()
+	defer service.ServiceLock.Unlock()
+	for userId, sockets := range service.UserSockets {
+		for _, socket := range sockets {
+			err := socket.SendEncoded(encoded)
+			if err != nil {
+				log.Printf("socket write json error for user %d: %v", userId, err)
+				continue
+			}
 		}
 	}
 }
 
-func (service *SocketService) GetSocketByUserId(userId int) (*websocket.Conn, error) {
-	socket, ok := service.UserSockets[userId]
-	if !ok {
+// SendMessageToUser delivers the message to every device of the user.
+func (service *SocketService) SendMessageToUser(userId int, message *SocketMessage) error {
+	sockets, err := service.GetSocketsByUserId(userId)
+	if err != nil {
+		return err
+	}
+	encoded, err := EncodeSocketMessage(message)
+	if err != nil {
+		return err
+	}
+	var sendErrors []error
+	for _, socket := range sockets {
+		if err := socket.SendEncoded(encoded); err != nil {
+			sendErrors = append(sendErrors, err)
+		}
+	}
+	return errors.Join(sendErrors...)
+}
+
+// IsConnected reports whether the user has at least one open connection.
+func (service *SocketService) IsConnected(userId int) bool {
+	service.ServiceLock.Lock()
+	defer service.ServiceLock.Unlock()
+	return len(service.UserSockets[userId]) > 0
+}
+
+func (service *SocketService) GetSocketsByUserId(userId int) ([]*SocketConnection, error) {
+	service.ServiceLock.Lock()
+	defer service.ServiceLock.Unlock()
+	sockets, ok := service.UserSockets[userId]
+	if !ok || len(sockets) == 0 {
 		return nil, errors.New("user not found in all sockets")
 	}
+	result := make([]*SocketConnection, 0, len(sockets))
+	for _, socket := range sockets {
+		result = append(result, socket)
+	}
+	return result, nil
+}
+
+func (service *SocketService) GetSocket(userId int, connectionId uuid.UUID) (*SocketConnection, error) {
+	service.ServiceLock.Lock()
+	defer service.ServiceLock.Unlock()
+	socket, ok := service.UserSockets[userId][connectionId]
+	if !ok {
+		return nil, fmt.Errorf("connection %v of user %d not found", connectionId, userId)
+	}
 	return socket, nil
 }
 
-func (service *SocketService) RemoveSocket(userId int) error {
+// RemoveSocket closes one connection of the user. Their other devices stay connected.
+func (service *SocketService) RemoveSocket(userId int, connectionId uuid.UUID) error {
 	service.ServiceLock.Lock()
 	defer service.ServiceLock.Unlock()
 
-	socket, ok := service.UserSockets[userId]
+	sockets, ok := service.UserSockets[userId]
 	if !ok {
 		return fmt.Errorf("user %d not exist", userId)
 	}
-	delete(service.UserSockets, userId)
-	err := socket.Close()
-	if err != nil {
-		return fmt.Errorf("socket close error: %s", err.Error())
+	socket, ok := sockets[connectionId]
+	if !ok {
+		return fmt.Errorf("connection %v of user %d not exist", connectionId, userId)
+	}
+	delete(sockets, connectionId)
+	if len(sockets) == 0 {
+		delete(service.UserSockets, userId)
 	}
+	socket.Close()
 	return nil
 }
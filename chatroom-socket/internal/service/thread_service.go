@@ -0,0 +1,80 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// getThreadId returns the message that a reply to parentId belongs to. Replies to a reply
+// go to the thread of its parent, so threads stay one level deep.
+func (service *ChatMessageService) getThreadId(ctx context.Context, room *SocketRoom, parentId string) (string, error) {
+	parent, parentRoom, err := service.getRoomMessage(ctx, parentId)
+	if err != nil {
+		return "", err
+	}
+	if parentRoom.Read().ID != room.Read().ID {
+		return "", fmt.Errorf("%w: %v is not in room %v", ErrMessageNotFound, parentId, room.Read().ID)
+	}
+	if parent.IsDeleted {
+		return "", fmt.Errorf("%w: %v", ErrMessageDeleted, parentId)
+	}
+	if parent.ParentId != nil {
+		return *parent.ParentId, nil
+	}
+	return parent.ID, nil
+}
+
+// GetThread returns the message starting the thread and a page of its replies, oldest first.
+// Threads of private rooms are only shown to their members.
+func (service *ChatMessageService) GetThread(ctx context.Context, user User, messageId string, offset uint, limit uint) (*ChatMessage, []*ChatMessage, error) {
+	parent, room, err := service.getRoomMessage(ctx, messageId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if room.Read().RoomType == RoomTypePrivate && !room.Read().IsOwnedBy(user.ID) {
+		isMember, err := service.RoomService.chatRoomRepository.IsRoomMember(ctx, room.Read().ID, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !isMember {
+			return nil, nil, fmt.Errorf("%w: %v", ErrNotRoomMember, room.Read().ID)
+		}
+	}
+	if parent.ParentId != nil {
+		if parent, _, err = service.getRoomMessage(ctx, *parent.ParentId); err != nil {
+			return nil, nil, err
+		}
+	}
+	replies, err := service.chatMessageRepository.GetThreadMessages(ctx, parent.ID, offset, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parent, replies, nil
+}
+
+// notifyThreadParticipants sends the reply to everyone in the thread wherever they are,
+// so they hear about it even when they are not in the room.
+func (service *ChatMessageService) notifyThreadParticipants(ctx context.Context, reply *ChatMessage) {
+	participantIds, err := service.chatMessageRepository.GetThreadParticipantIds(ctx, *reply.ParentId)
+	if err != nil {
+		log.Println(fmt.Sprintf("unable to get participants of thread %v: %v", *reply.ParentId, err))
+		return
+	}
+	body, err := json.Marshal(reply)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	socketMessage := NewSocketMessage(EventThreadReply, string(body))
+	for _, userId := range participantIds {
+		if userId == reply.SenderId || !service.RoomService.lobby.IsConnected(userId) {
+			continue
+		}
+		if err := service.RoomService.lobby.SendMessageToUser(userId, socketMessage); err != nil {
+			log.Println(fmt.Sprintf("unable to notify user %v of thread reply %v: %v", userId, reply.ID, err))
+		}
+	}
+}
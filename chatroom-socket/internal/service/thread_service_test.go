@@ -0,0 +1,25 @@
+package service
+
+import (
+	. "chatroom-socket/internal/repository"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetThreadOfPrivateRoom(t *testing.T) {
+	service, repository, _ := newTestChatMessageService(t)
+	room := addTestRoom(t, service.RoomService, RoomTypePrivate, testOwnerId)
+	parent := repository.addMessage(room.Read().ID, testOwnerId)
+	reply := repository.addMessage(room.Read().ID, testOwnerId)
+	reply.ParentId = &parent.ID
+	ctx := context.Background()
+
+	if _, _, err := service.GetThread(ctx, User{ID: 2}, reply.ID, 0, 10); !errors.Is(err, ErrNotRoomMember) {
+		t.Errorf("stranger: got %v, want %v", err, ErrNotRoomMember)
+	}
+	thread, replies, err := service.GetThread(ctx, User{ID: testOwnerId}, reply.ID, 0, 10)
+	if err != nil || thread.ID != parent.ID || len(replies) != 1 {
+		t.Errorf("owner: got thread %v with %d replies, %v", thread, len(replies), err)
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	. "chatroom-socket/internal/repository"
 	"github.com/google/uuid"
+	"time"
 )
 
 type RoomView struct {
@@ -10,4 +11,58 @@ type RoomView struct {
 	NumberOfPeople uint      `json:"number_of_people"`
 	RoomName       string    `json:"room_name"`
 	RoomType       RoomType  `json:"room_type"`
+	OwnerId        *int      `json:"owner_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type Presence string
+
+const (
+	PresenceInRoom  Presence = "in_room"
+	PresenceOnline  Presence = "online"
+	PresenceAway    Presence = "away"
+	PresenceOffline Presence = "offline"
+)
+
+type UserPresenceView struct {
+	UserPresence
+	Presence Presence `json:"presence"`
+}
+
+type RoomMemberView struct {
+	RoomMember
+	Presence Presence `json:"presence"`
+}
+
+// RoomSnapshot is pushed to a user right after joining so that the room can be rendered at once.
+type RoomSnapshot struct {
+	Room     *Room             `json:"room"`
+	Settings *ChatRoomSettings `json:"settings"`
+	Members  []RoomMemberView  `json:"members"`
+	Messages []*ChatMessage    `json:"messages"` // Latest first, like GET /api/message/:room_id.
+}
+
+type RoomSortField string
+
+const (
+	RoomSortByNumberOfPeople RoomSortField = "number_of_people"
+	RoomSortByName           RoomSortField = "name"
+	RoomSortByCreatedAt      RoomSortField = "created_at"
+)
+
+// RoomViewQuery filters, sorts and paginates the room directory. Zero values disable a filter.
+type RoomViewQuery struct {
+	RoomType   RoomType      `form:"room_type"`
+	OwnerId    int           `form:"owner_id"`
+	Name       string        `form:"name"`
+	SortBy     RoomSortField `form:"sort_by"`
+	Descending bool          `form:"descending"`
+	Limit      int           `form:"limit"` // 0 returns every matching room.
+	Cursor     string        `form:"cursor"`
+}
+
+type RoomViewPage struct {
+	Rooms      []RoomView `json:"rooms"`
+	Total      int        `json:"total"`
+	NextCursor string     `json:"next_cursor"`
 }
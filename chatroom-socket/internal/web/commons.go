@@ -2,8 +2,11 @@ package web
 
 import (
 	"chatroom-socket/internal/repository"
+	"chatroom-socket/internal/service"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"net/http"
 )
 
@@ -18,6 +21,57 @@ func HandleBadRequest(c *gin.Context, err error) {
 	c.Abort()
 }
 
+var errorCodeStatus = map[service.ErrorCode]int{
+	service.CodeRoomNotFound:            http.StatusNotFound,
+	service.CodeRoomNotReady:            http.StatusServiceUnavailable,
+	service.CodeRoomPasswordRequired:    http.StatusUnauthorized,
+	service.CodeWrongRoomPassword:       http.StatusForbidden,
+	service.CodeTooManyPasswordAttempts: http.StatusTooManyRequests,
+	service.CodeNotRoomOwner:            http.StatusForbidden,
+	service.CodeNotRoomMember:           http.StatusForbidden,
+	service.CodeInviteNotFound:          http.StatusNotFound,
+	service.CodeInviteExpired:           http.StatusGone,
+	service.CodeInviteExhausted:         http.StatusGone,
+	service.CodeInsufficientRoomRole:    http.StatusForbidden,
+	service.CodeUserBanned:              http.StatusForbidden,
+	service.CodeUserMuted:               http.StatusForbidden,
+	service.CodeAdminRequired:           http.StatusForbidden,
+	service.CodeInvalidMessage:          http.StatusBadRequest,
+	service.CodeSessionNotFound:         http.StatusNotFound,
+	service.CodeUnknownEvent:            http.StatusBadRequest,
+	service.CodeRateLimited:             http.StatusTooManyRequests,
+	service.CodeMessageNotFound:         http.StatusNotFound,
+	service.CodeNotMessageSender:        http.StatusForbidden,
+	service.CodeMessageDeleted:          http.StatusGone,
+	service.CodeReactionLimitReached:    http.StatusConflict,
+	service.CodePinLimitReached:         http.StatusConflict,
+	service.CodeUserNotFound:            http.StatusNotFound,
+}
+
+// HandleServiceError responds with the status and code of a service.ServiceError,
+// falling back to HandleBadRequest for untyped errors.
+func HandleServiceError(c *gin.Context, err error) {
+	code := service.GetErrorCode(err)
+	statusCode, ok := errorCodeStatus[code]
+	if !ok {
+		HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(statusCode, gin.H{
+		"error": err.Error(),
+		"code":  code,
+	})
+	c.Abort()
+}
+
+func GetUUIDParam(c *gin.Context, key string) (uuid.UUID, error) {
+	value, err := uuid.Parse(c.Param(key))
+	if err != nil || value == uuid.Nil {
+		return uuid.Nil, fmt.Errorf("%s is not a valid id", key)
+	}
+	return value, nil
+}
+
 func GetUserFromContext(c *gin.Context) (*repository.User, error) {
 	userInterface, ok := c.Get(UserKey)
 	if !ok {
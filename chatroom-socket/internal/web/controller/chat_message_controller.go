@@ -32,6 +32,255 @@ func NewChatMessageController(router *gin.RouterGroup, roomService *service.Room
 func (controller *ChatMessageController) RegisterRoutes() {
 	controller.Router.GET("/message/:room_id", controller.GetChatMessagesByRoomId)
 	controller.Router.POST("/send_chat_message", controller.SendMessageToRoomId)
+	controller.Router.GET("/unread_counts", controller.GetUnreadCounts)
+	controller.Router.GET("/mentions", controller.GetUnreadMentions)
+	controller.Router.PUT("/chat_message/:message_id", controller.EditMessage)
+	controller.Router.DELETE("/chat_message/:message_id", controller.DeleteMessage)
+	controller.Router.GET("/chat_message/:message_id/history", controller.GetMessageEdits)
+	controller.Router.GET("/chat_message/:message_id/thread", controller.GetThread)
+	controller.Router.POST("/chat_message/:message_id/reactions", controller.AddReaction)
+	controller.Router.DELETE("/chat_message/:message_id/reactions/:emoji", controller.RemoveReaction)
+	controller.Router.POST("/chat_message/:message_id/pin", controller.PinMessage)
+	controller.Router.DELETE("/chat_message/:message_id/pin", controller.UnpinMessage)
+	controller.Router.GET("/chat_room/:room_id/pinned_messages", controller.GetPinnedMessages)
+}
+
+func (controller *ChatMessageController) GetThread(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	limit, err := strconv.ParseUint(c.Query("message_limit"), 10, 64)
+	if err != nil || limit == 0 {
+		web.HandleBadRequest(c, errors.New("message limit must be provided, and can't be 0"))
+		return
+	}
+	messageOffset, err := strconv.ParseUint(c.Query("message_offset"), 10, 64)
+	if err != nil {
+		web.HandleBadRequest(c, errors.New("message offset must be provided"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	parent, replies, err := controller.ChatMessageService.GetThread(ctx, *user, messageId.String(), uint(messageOffset), uint(limit))
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"parent": parent, "replies": replies})
+}
+
+func (controller *ChatMessageController) AddReaction(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	var schema struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.ChatMessageService.AddReaction(ctx, *user, messageId.String(), schema.Emoji); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageId, "emoji": schema.Emoji})
+}
+
+func (controller *ChatMessageController) RemoveReaction(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	emoji := c.Param("emoji")
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.ChatMessageService.RemoveReaction(ctx, *user, messageId.String(), emoji); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageId, "emoji": emoji})
+}
+
+func (controller *ChatMessageController) PinMessage(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.ChatMessageService.PinMessage(ctx, *user, messageId.String()); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageId})
+}
+
+func (controller *ChatMessageController) UnpinMessage(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.ChatMessageService.UnpinMessage(ctx, *user, messageId.String()); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageId})
+}
+
+func (controller *ChatMessageController) GetPinnedMessages(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	pinnedMessages, err := controller.ChatMessageService.GetPinnedMessages(ctx, *user, roomId)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pinned_messages": pinnedMessages})
+}
+
+// GetUnreadMentions lists the unread mentions of the user, limited by the optional limit query.
+func (controller *ChatMessageController) GetUnreadMentions(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var limit uint64
+	if limitParam := c.Query("limit"); len(limitParam) != 0 {
+		if limit, err = strconv.ParseUint(limitParam, 10, 64); err != nil {
+			web.HandleBadRequest(c, errors.New("limit must be a positive integer"))
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	mentions, err := controller.ChatMessageService.GetUnreadMentions(ctx, user.ID, uint(limit))
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"mentions": mentions})
+}
+
+func (controller *ChatMessageController) EditMessage(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	var schema struct {
+		Content string `json:"content"`
+	}
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	message, err := controller.ChatMessageService.EditMessage(ctx, *user, messageId.String(), schema.Content)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+func (controller *ChatMessageController) DeleteMessage(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.ChatMessageService.DeleteMessage(ctx, *user, messageId.String()); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": messageId})
+}
+
+func (controller *ChatMessageController) GetMessageEdits(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	messageId, err := web.GetUUIDParam(c, "message_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	edits, err := controller.ChatMessageService.GetMessageEdits(ctx, *user, messageId.String())
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"edits": edits})
+}
+
+func (controller *ChatMessageController) GetUnreadCounts(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	unreadCounts, err := controller.ChatMessageService.GetUnreadCounts(ctx, user.ID)
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread_counts": unreadCounts})
 }
 
 func (controller *ChatMessageController) GetChatMessagesByRoomId(c *gin.Context) {
@@ -40,6 +289,11 @@ func (controller *ChatMessageController) GetChatMessagesByRoomId(c *gin.Context)
 		web.HandleBadRequest(c, errors.New("room_id is required"))
 		return
 	}
+	// Only listed rooms are readable here. Direct conversations go through their own endpoint.
+	if _, err := controller.RoomService.GetRoom(roomId); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
 
 	limit, err := strconv.ParseUint(c.Query("message_limit"), 10, 64)
 	if err != nil || limit == 0 {
@@ -80,7 +334,7 @@ func (controller *ChatMessageController) SendMessageToRoomId(c *gin.Context) {
 		return
 	}
 
-	response, err := controller.ChatMessageService.SendMessageToRoomId(ctx, user.ID, chatMessage.Content)
+	response, err := controller.ChatMessageService.SendMessageToRoomId(ctx, user.ID, chatMessage.Content, messageSchema.ParentId)
 	if err != nil {
 		web.HandleBadRequest(c, err)
 		return
@@ -40,6 +40,22 @@ func (controller *RoomController) RegisterRoutes() {
 	controller.Router.POST("/chat_room", controller.CreateNewRoom)
 	controller.Router.GET("/chat_room_settings/:room_id", controller.GetChatRoomSettings)
 	controller.Router.DELETE("/chat_room/:room_id", controller.DeleteRoom)
+	controller.Router.PUT("/chat_room/:room_id", controller.EditRoom)
+	controller.Router.PATCH("/chat_room/:room_id", controller.EditRoom)
+	controller.Router.GET("/chat_room/:room_id/members", controller.GetRoomMembers)
+	controller.Router.POST("/chat_room/:room_id/members", controller.InviteUser)
+	controller.Router.POST("/chat_room/:room_id/invite", controller.CreateRoomInvite)
+	controller.Router.GET("/room_invite/:invite_code", controller.GetRoomInvite)
+	controller.Router.POST("/chat_room/:room_id/kick", controller.ModerateUser(service.ModerationKick))
+	controller.Router.POST("/chat_room/:room_id/mute", controller.ModerateUser(service.ModerationMute))
+	controller.Router.POST("/chat_room/:room_id/unmute", controller.ModerateUser(service.ModerationUnmute))
+	controller.Router.POST("/chat_room/:room_id/ban", controller.ModerateUser(service.ModerationBan))
+	controller.Router.POST("/chat_room/:room_id/unban", controller.ModerateUser(service.ModerationUnban))
+	controller.Router.POST("/chat_room/:room_id/role", controller.ModerateUser(service.ModerationSetRole))
+	controller.Router.POST("/chat_room/:room_id/transfer_ownership", controller.TransferOwnership)
+	controller.Router.GET("/orphaned_rooms", controller.GetOrphanedRooms)
+	controller.Router.GET("/archived_rooms", controller.GetArchivedRooms)
+	controller.Router.POST("/chat_room/:room_id/restore", controller.RestoreRoom)
 }
 
 func (controller *RoomController) UserLocation(c *gin.Context) {
@@ -61,10 +77,17 @@ func (controller *RoomController) UserLocation(c *gin.Context) {
 }
 
 func (controller *RoomController) AllRooms(c *gin.Context) {
-	rooms := controller.RoomService.GetAllRoomViews()
-	c.JSON(http.StatusOK, gin.H{
-		"rooms": rooms,
-	})
+	var query service.RoomViewQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	page, err := controller.RoomService.GetAllRoomViews(&query)
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func (controller *RoomController) GetChatRoomSettings(c *gin.Context) {
@@ -89,7 +112,9 @@ func (controller *RoomController) GetChatRoomSettings(c *gin.Context) {
 
 func (controller *RoomController) UserJoinRoom(c *gin.Context) {
 	var schema struct {
-		RoomId uuid.UUID `json:"room_id"`
+		RoomId       uuid.UUID `json:"room_id"`
+		ConnectionId uuid.UUID `json:"connection_id"` // Joins with every connection of the user when empty.
+		service.JoinRoomCredentials
 	}
 	user, err := web.GetUserFromContext(c)
 	if err != nil {
@@ -99,15 +124,16 @@ func (controller *RoomController) UserJoinRoom(c *gin.Context) {
 		web.HandleBadRequest(c, err)
 		return
 	}
-	socket, err := controller.SocketService.GetSocketByUserId(user.ID)
-
+	sockets, err := controller.getUserSockets(user.ID, schema.ConnectionId)
 	if err != nil {
 		web.HandleBadRequest(c, err)
 		return
 	}
 
-	if err := controller.RoomService.UserJoinRoom(schema.RoomId, *user, socket); err != nil {
-		web.HandleBadRequest(c, err)
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.RoomService.UserJoinRoom(ctx, schema.RoomId, *user, sockets, schema.JoinRoomCredentials); err != nil {
+		web.HandleServiceError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -116,13 +142,34 @@ func (controller *RoomController) UserJoinRoom(c *gin.Context) {
 	})
 }
 
+func (controller *RoomController) getUserSockets(userId int, connectionId uuid.UUID) ([]*service.SocketConnection, error) {
+	if connectionId == uuid.Nil {
+		return controller.SocketService.GetSocketsByUserId(userId)
+	}
+	socket, err := controller.SocketService.GetSocket(userId, connectionId)
+	if err != nil {
+		return nil, err
+	}
+	return []*service.SocketConnection{socket}, nil
+}
+
+// UserLeaveRoom takes the user out of their room with all devices, or only the device given by connection_id.
 func (controller *RoomController) UserLeaveRoom(c *gin.Context) {
 	user, err := web.GetUserFromContext(c)
 	if err != nil {
 		return
 	}
 
-	_, err = controller.RoomService.UserLeaveRoom(*user)
+	if connectionIdParam := c.Query("connection_id"); len(connectionIdParam) != 0 {
+		connectionId, parseErr := uuid.Parse(connectionIdParam)
+		if parseErr != nil {
+			web.HandleBadRequest(c, parseErr)
+			return
+		}
+		err = controller.RoomService.ConnectionLeaveRoom(*user, connectionId)
+	} else {
+		_, err = controller.RoomService.UserLeaveRoom(*user)
+	}
 
 	if err != nil {
 		web.HandleBadRequest(c, err)
@@ -142,6 +189,7 @@ func (controller *RoomController) UserSwitchRoom(c *gin.Context) {
 
 	var schema struct {
 		TargetRoomId uuid.UUID `json:"target_room_id"`
+		service.JoinRoomCredentials
 	}
 	if err := c.BindJSON(&schema); err != nil {
 		web.HandleBadRequest(c, err)
@@ -153,8 +201,10 @@ func (controller *RoomController) UserSwitchRoom(c *gin.Context) {
 		return
 	}
 
-	if err := controller.RoomService.UserSwitchRoom(*user, schema.TargetRoomId); err != nil {
-		web.HandleBadRequest(c, err)
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.RoomService.UserSwitchRoom(ctx, *user, schema.TargetRoomId, schema.JoinRoomCredentials); err != nil {
+		web.HandleServiceError(c, err)
 		return
 	}
 
@@ -184,8 +234,37 @@ func (controller *RoomController) CreateNewRoom(c *gin.Context) {
 		web.HandleBadRequest(c, err)
 		return
 	}
-	log.Println(fmt.Sprintf("SocketRoom created: %v", room.Read.ID))
-	c.JSON(http.StatusOK, gin.H{"message": room.Read})
+	log.Println(fmt.Sprintf("SocketRoom created: %v", room.Read().ID))
+	c.JSON(http.StatusOK, gin.H{"message": room.Read()})
+}
+
+func (controller *RoomController) EditRoom(c *gin.Context) {
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var schema service.UpdateRoomSchema
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	room, settings, err := controller.RoomService.EditRoom(ctx, user.ID, roomId, &schema)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  room.Read(),
+		"settings": settings,
+	})
 }
 
 func (controller *RoomController) DeleteRoom(c *gin.Context) {
@@ -208,3 +287,40 @@ func (controller *RoomController) DeleteRoom(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "delete room successfully"})
 
 }
+
+func (controller *RoomController) GetArchivedRooms(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	rooms, err := controller.RoomService.GetArchivedRooms(ctx, *user)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rooms": rooms})
+}
+
+func (controller *RoomController) RestoreRoom(c *gin.Context) {
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	room, err := controller.RoomService.RestoreRoom(ctx, *user, roomId)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": room.Read()})
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"chatroom-socket/internal/service"
+	"chatroom-socket/internal/web"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+func (controller *RoomController) GetRoomMembers(c *gin.Context) {
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	members, err := controller.RoomService.GetRoomMembers(ctx, user.ID, roomId)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+func (controller *RoomController) InviteUser(c *gin.Context) {
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var schema struct {
+		UserId int `json:"user_id"`
+	}
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	if schema.UserId == 0 {
+		web.HandleBadRequest(c, errors.New("user_id is required"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	room, err := controller.RoomService.InviteUser(ctx, user.ID, roomId, schema.UserId)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	invitation := service.NewSocketMessage(
+		service.EventRoomInvitation,
+		fmt.Sprintf("User: %v invited you to room %v", user.UserName, room.Read().Name),
+	)
+	if err := controller.SocketService.SendMessageToUser(schema.UserId, invitation); err != nil {
+		log.Println(fmt.Sprintf("unable to notify invited user %v: %v", schema.UserId, err))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("user %v invited to room %s", schema.UserId, roomId)})
+}
+
+func (controller *RoomController) CreateRoomInvite(c *gin.Context) {
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var schema service.CreateRoomInviteSchema
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	invite, err := controller.RoomService.CreateRoomInvite(ctx, user.ID, roomId, &schema)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"invite":      invite,
+		"invite_link": fmt.Sprintf("%s://%s/api/room_invite/%s", scheme, c.Request.Host, invite.Code),
+	})
+}
+
+func (controller *RoomController) GetRoomInvite(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	invite, err := controller.RoomService.GetRoomInvite(ctx, c.Param("invite_code"))
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	room, err := controller.RoomService.GetRoom(invite.RoomId)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"invite": invite,
+		"room":   room.Read(),
+	})
+}
+
+func (controller *RoomController) ModerateUser(action service.ModerationAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomId, err := web.GetUUIDParam(c, "room_id")
+		if err != nil {
+			web.HandleBadRequest(c, err)
+			return
+		}
+		user, err := web.GetUserFromContext(c)
+		if err != nil {
+			return
+		}
+		var schema service.ModerationSchema
+		if err := c.BindJSON(&schema); err != nil {
+			web.HandleBadRequest(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+		defer cancel()
+
+		if err := controller.RoomService.ModerateUser(ctx, *user, roomId, action, &schema); err != nil {
+			web.HandleServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%v applied to user %v", action, schema.UserId)})
+	}
+}
+
+func (controller *RoomController) TransferOwnership(c *gin.Context) {
+	roomId, err := web.GetUUIDParam(c, "room_id")
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var schema struct {
+		UserId int `json:"user_id"`
+	}
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	if err := controller.RoomService.TransferOwnership(ctx, *user, roomId, schema.UserId); err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("room %s is now owned by user %v", roomId, schema.UserId)})
+}
+
+func (controller *RoomController) GetOrphanedRooms(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	orphanedRooms, err := controller.RoomService.GetOrphanedRooms(ctx, *user)
+	if err != nil {
+		web.HandleServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rooms": orphanedRooms})
+}
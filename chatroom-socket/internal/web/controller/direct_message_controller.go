@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"chatroom-socket/internal/service"
+	"chatroom-socket/internal/web"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type DirectMessageController struct {
+	Router                 *gin.RouterGroup
+	DirectMessageService   *service.DirectMessageService
+	RequestTimeoutDuration time.Duration
+}
+
+func NewDirectMessageController(router *gin.RouterGroup, directMessageService *service.DirectMessageService, requestTimeoutSeconds int) *DirectMessageController {
+	return &DirectMessageController{
+		Router:                 router,
+		DirectMessageService:   directMessageService,
+		RequestTimeoutDuration: time.Duration(requestTimeoutSeconds) * time.Second,
+	}
+}
+
+func (controller *DirectMessageController) RegisterRoutes() {
+	controller.Router.GET("/direct_messages", controller.GetConversations)
+	controller.Router.GET("/direct_message/:user_id", controller.GetDirectMessages)
+	controller.Router.POST("/direct_message", controller.SendDirectMessage)
+}
+
+func (controller *DirectMessageController) GetConversations(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	conversations, err := controller.DirectMessageService.GetConversations(ctx, user.ID)
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
+}
+
+func (controller *DirectMessageController) GetDirectMessages(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	otherUserId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil || otherUserId == 0 {
+		web.HandleBadRequest(c, errors.New("user_id is not valid"))
+		return
+	}
+	limit, err := strconv.ParseUint(c.Query("message_limit"), 10, 64)
+	if err != nil || limit == 0 {
+		web.HandleBadRequest(c, errors.New("message limit must be provided, and can't be 0"))
+		return
+	}
+	messageOffset, err := strconv.ParseUint(c.Query("message_offset"), 10, 64)
+	if err != nil {
+		web.HandleBadRequest(c, errors.New("message offset must be provided"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	messages, err := controller.DirectMessageService.GetDirectMessages(ctx, user.ID, otherUserId, uint(messageOffset), uint(limit))
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+func (controller *DirectMessageController) SendDirectMessage(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var schema struct {
+		RecipientId int    `json:"recipient_id"`
+		Content     string `json:"content"`
+	}
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+
+	message, err := controller.DirectMessageService.SendDirectMessage(ctx, *user, schema.RecipientId, schema.Content)
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"chatroom-socket/internal/service"
+	"chatroom-socket/internal/web"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxPresenceUserIds = 200
+
+type PresenceController struct {
+	Router                 *gin.RouterGroup
+	PresenceService        *service.PresenceService
+	RequestTimeoutDuration time.Duration
+}
+
+func NewPresenceController(router *gin.RouterGroup, presenceService *service.PresenceService, requestTimeoutSeconds int) *PresenceController {
+	return &PresenceController{
+		Router:                 router,
+		PresenceService:        presenceService,
+		RequestTimeoutDuration: time.Duration(requestTimeoutSeconds) * time.Second,
+	}
+}
+
+func (controller *PresenceController) RegisterRoutes() {
+	controller.Router.GET("/presence", controller.GetUserPresences)
+	controller.Router.PUT("/presence/status", controller.SetStatusText)
+}
+
+// GetUserPresences returns the presence of the comma separated user_ids.
+func (controller *PresenceController) GetUserPresences(c *gin.Context) {
+	if _, err := web.GetUserFromContext(c); err != nil {
+		return
+	}
+	var userIds []int
+	for _, value := range strings.Split(c.Query("user_ids"), ",") {
+		if len(value) == 0 {
+			continue
+		}
+		userId, err := strconv.Atoi(value)
+		if err != nil {
+			web.HandleBadRequest(c, errors.New("user_ids must be comma separated integers"))
+			return
+		}
+		userIds = append(userIds, userId)
+	}
+	if len(userIds) == 0 || len(userIds) > maxPresenceUserIds {
+		web.HandleBadRequest(c, fmt.Errorf("user_ids must contain between 1 and %d ids", maxPresenceUserIds))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	presences, err := controller.PresenceService.GetUserPresences(ctx, userIds)
+	if err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"presences": presences})
+}
+
+func (controller *PresenceController) SetStatusText(c *gin.Context) {
+	user, err := web.GetUserFromContext(c)
+	if err != nil {
+		return
+	}
+	var schema service.SetStatusSchema
+	if err := c.BindJSON(&schema); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+	defer cancel()
+	if err := controller.PresenceService.SetStatusText(ctx, *user, schema.StatusText); err != nil {
+		web.HandleBadRequest(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status_text": schema.StatusText})
+}
@@ -5,17 +5,20 @@ import (
 	"chatroom-socket/internal/service"
 	"chatroom-socket/internal/web"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    service.SupportedSubprotocols(),
 	CheckOrigin: func(r *http.Request) bool {
 		// Allow all connections by default
 		return true
@@ -26,7 +29,9 @@ type SocketController struct {
 	Router                 *gin.RouterGroup
 	SocketService          *service.SocketService
 	RoomService            *service.RoomService
-	ChatMessageService     *service.ChatMessageService
+	SessionService         *service.SessionService
+	EventRegistry          *service.SocketEventRegistry
+	PresenceService        *service.PresenceService
 	RequestTimeoutDuration time.Duration
 }
 
@@ -37,12 +42,14 @@ func (controller *SocketController) RegisterRoutes() {
 	controller.Router.POST("/send_notification", controller.SendNotification)
 }
 
-func NewSocketController(router *gin.RouterGroup, socketService *service.SocketService, roomService *service.RoomService, chatMessageService *service.ChatMessageService, requestTimeoutSeconds int) *SocketController {
+func NewSocketController(router *gin.RouterGroup, socketService *service.SocketService, roomService *service.RoomService, sessionService *service.SessionService, eventRegistry *service.SocketEventRegistry, presenceService *service.PresenceService, requestTimeoutSeconds int) *SocketController {
 	return &SocketController{
 		Router:                 router,
 		SocketService:          socketService,
 		RoomService:            roomService,
-		ChatMessageService:     chatMessageService,
+		SessionService:         sessionService,
+		EventRegistry:          eventRegistry,
+		PresenceService:        presenceService,
 		RequestTimeoutDuration: time.Duration(requestTimeoutSeconds) * time.Second,
 	}
 }
@@ -57,6 +64,36 @@ func (controller *SocketController) SendNotification(c *gin.Context) {
 	controller.SocketService.SendNotification(service.NewSocketMessage(service.EventNotification, message.Content))
 }
 
+// openSession resumes the session given by the session_token query parameter, replaying the room
+// broadcasts after last_seq. Otherwise it starts a new session.
+func (controller *SocketController) openSession(c *gin.Context, user repository.User, connection *service.SocketConnection) (*service.SocketSession, error) {
+	if token := c.Query("session_token"); len(token) != 0 {
+		lastSeq, _ := strconv.ParseUint(c.Query("last_seq"), 10, 64)
+		ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+		defer cancel()
+		session, replacedConnectionId, err := controller.SessionService.ResumeSession(ctx, user, token, lastSeq, connection)
+		if err == nil {
+			// The replaced connection may not have noticed yet that the client is gone.
+			_ = controller.SocketService.RemoveSocket(user.ID, replacedConnectionId)
+			return session, nil
+		}
+		log.Println(fmt.Sprintf("Unable to resume session of user %v: %v", user.UserName, err))
+		if err := connection.SendError("", err); err != nil {
+			log.Println(err)
+		}
+	}
+
+	session, err := controller.SessionService.StartSession(user, connection)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(gin.H{"connection_id": connection.Id, "session_token": session.Token})
+	if err != nil {
+		return nil, err
+	}
+	return session, connection.Send(service.NewSocketMessage(service.EventConnectionEstablished, string(body)))
+}
+
 func (controller *SocketController) WebSocketHandler(c *gin.Context) {
 	// Upgrade the HTTP request to a WebSocket connection
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -64,6 +101,9 @@ func (controller *SocketController) WebSocketHandler(c *gin.Context) {
 		log.Println("Failed to upgrade to WebSocket:", err)
 		return
 	}
+	// Only the connection's writer goroutine may write to conn from here on.
+	connection := controller.SocketService.NewConnection(conn)
+	defer connection.Close()
 	userInterface, ok := c.Get(web.UserKey)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -74,41 +114,54 @@ func (controller *SocketController) WebSocketHandler(c *gin.Context) {
 	}
 	user, ok := userInterface.(repository.User)
 	if ok {
-		controller.SocketService.AddSocket(conn, user.ID)
-		if err := conn.WriteJSON(service.NewSocketMessage(service.EventGreeting, fmt.Sprintf("Welcome back %v", user.UserName))); err != nil {
+		controller.SocketService.AddSocket(connection, user.ID)
+		if err := connection.Send(service.NewSocketMessage(service.EventGreeting, fmt.Sprintf("Welcome back %v", user.UserName))); err != nil {
 			log.Println("Failed to send message to user:", err)
 		}
+		session, err := controller.openSession(c, user, connection)
+		if err != nil {
+			log.Println("Failed to open session:", err)
+			_ = controller.SocketService.RemoveSocket(user.ID, connection.Id)
+			return
+		}
+		controller.PresenceService.UserConnected(context.Background(), user)
 		defer func() {
-			if err := controller.SocketService.RemoveSocket(user.ID); err != nil {
-				return
-			}
-			if _, err = controller.RoomService.UserLeaveRoom(user); err != nil {
+			if err := controller.SocketService.RemoveSocket(user.ID, connection.Id); err != nil {
 				return
 			}
+			ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
+			defer cancel()
+			// Announce the presence change while the user is still in their room.
+			controller.PresenceService.UserDisconnected(ctx, user)
+			controller.SessionService.EndConnection(user, session.Token, connection.Id)
 		}()
 	}
 	for {
-		var socketMessage service.SocketMessage
-		err := conn.ReadJSON(&socketMessage)
-		if len(socketMessage.Event) == 0 {
-			err = fmt.Errorf("event key not found in socket message")
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Println(fmt.Sprintf("Error reading message: %v", err))
+			break
 		}
+		connection.Touch()
+		request, err := service.DecodeSocketRequest(connection.Version, data)
 		if err != nil {
-			message := fmt.Sprintf("Error reading message: %v", err)
-			log.Println(message)
-			if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			if err := connection.SendError("", err); err != nil {
 				log.Println(err.Error())
 			}
-			break
+			continue
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), controller.RequestTimeoutDuration)
-		defer cancel()
-		if err := controller.ChatMessageService.ReceiveSocketMessage(ctx, user, socketMessage.Event, socketMessage.Content); err != nil {
-			message := err.Error()
-			if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
-				log.Println(message)
-			}
+		controller.PresenceService.RecordActivity(ctx, user)
+		err = controller.EventRegistry.Dispatch(ctx, user, request)
+		cancel()
+		if err != nil {
+			err = connection.SendError(request.Id, err)
+		} else {
+			err = connection.SendAck(request.Id, request.Event)
+		}
+		if err != nil {
+			log.Println(err.Error())
 		}
-		log.Printf("Received message: %s, from user:  %v", socketMessage, user.UserName)
+		log.Printf("Received message: %v, from user:  %v", request.Event, user.UserName)
 	}
 }